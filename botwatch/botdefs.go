@@ -0,0 +1,207 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package botwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"regexp"
+
+	"github.com/czcorpus/apiguard-common/common"
+)
+
+// BotAction specifies how requests of a matching bot should be handled
+type BotAction string
+
+const (
+
+	// BotActionAllow means the bot is allowed without any restrictions
+	BotActionAllow BotAction = "allow"
+
+	// BotActionIgnore means the bot's requests are served but they
+	// should not be considered in bot detection and statistics
+	BotActionIgnore BotAction = "ignore"
+
+	// BotActionBlock means the bot's requests should be rejected
+	BotActionBlock BotAction = "block"
+)
+
+func (a BotAction) Validate() error {
+	switch a {
+	case BotActionAllow, BotActionIgnore, BotActionBlock:
+		return nil
+	default:
+		return fmt.Errorf("invalid bot action '%s'", a)
+	}
+}
+
+// BotDef defines a single bot. A request matches the definition if
+// its User-Agent matches any of the UserAgents regexps and its IP
+// is in any of the IPRanges. An empty list matches anything but at
+// least one of the lists must be non-empty.
+type BotDef struct {
+	Name string `json:"name"`
+
+	// Category is an arbitrary bot category (e.g. "search", "monitoring", "ai")
+	Category string `json:"category"`
+
+	// UserAgents is a list of regular expressions (Go syntax)
+	UserAgents []string `json:"userAgents"`
+
+	// IPRanges is a list of CIDR ranges or individual IP addresses
+	IPRanges []string `json:"ipRanges"`
+
+	Action BotAction `json:"action"`
+}
+
+// BotDefs is a list of bot definitions as loaded from BotDefsPath.
+// The expected JSON format is:
+//
+//	{
+//	  "bots": [
+//	    {
+//	      "name": "Googlebot",
+//	      "category": "search",
+//	      "userAgents": ["(?i)googlebot"],
+//	      "ipRanges": ["66.249.64.0/19"],
+//	      "action": "allow"
+//	    }
+//	  ]
+//	}
+type BotDefs struct {
+	Bots []BotDef `json:"bots"`
+}
+
+// ParseBotDefs parses bot definitions in the JSON format
+func ParseBotDefs(data []byte) (*BotDefs, error) {
+	var ans BotDefs
+	if err := json.Unmarshal(data, &ans); err != nil {
+		return nil, fmt.Errorf("failed to parse bot definitions: %w", err)
+	}
+	return &ans, nil
+}
+
+// AddrExtractor determines a client address of a request
+// (e.g. guard.ClientAddr)
+type AddrExtractor func(req *http.Request) netip.Addr
+
+// -----
+
+type compiledDef struct {
+	def        *BotDef
+	userAgents []*regexp.Regexp
+	ipRanges   []netip.Prefix
+}
+
+func (cd *compiledDef) matches(userAgent string, addr netip.Addr) bool {
+	if len(cd.userAgents) > 0 {
+		var uaMatch bool
+		for _, rx := range cd.userAgents {
+			if rx.MatchString(userAgent) {
+				uaMatch = true
+				break
+			}
+		}
+		if !uaMatch {
+			return false
+		}
+	}
+	if len(cd.ipRanges) > 0 {
+		for _, prefix := range cd.ipRanges {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Matcher applies bot definitions to requests. It is read-only
+// once created and therefore safe for concurrent use.
+type Matcher struct {
+	defs       []compiledDef
+	clientAddr AddrExtractor
+}
+
+// Match returns the first definition matching the user agent and the IP
+// address (in the order of the definitions) or nil if there is none.
+func (m *Matcher) Match(userAgent string, addr netip.Addr) *BotDef {
+	addr = addr.Unmap()
+	for i := range m.defs {
+		if m.defs[i].matches(userAgent, addr) {
+			return m.defs[i].def
+		}
+	}
+	return nil
+}
+
+// MatchRequest returns the first definition matching the request.
+// The client address is determined by the matcher's AddrExtractor.
+func (m *Matcher) MatchRequest(req *http.Request) *BotDef {
+	return m.Match(req.UserAgent(), m.clientAddr(req))
+}
+
+// NumDefs returns number of bot definitions
+func (m *Matcher) NumDefs() int {
+	return len(m.defs)
+}
+
+// NewMatcher validates and compiles bot definitions. In case clientAddr
+// is nil, requests are matched by their immediate peer address
+// (see common.PeerAddr).
+func NewMatcher(defs *BotDefs, clientAddr AddrExtractor) (*Matcher, error) {
+	if clientAddr == nil {
+		clientAddr = common.PeerAddr
+	}
+	ans := &Matcher{
+		defs:       make([]compiledDef, len(defs.Bots)),
+		clientAddr: clientAddr,
+	}
+	for i := range defs.Bots {
+		def := &defs.Bots[i]
+		if def.Name == "" {
+			return nil, fmt.Errorf("bot definition %d has no name", i)
+		}
+		if err := def.Action.Validate(); err != nil {
+			return nil, fmt.Errorf("bot definition %s: %w", def.Name, err)
+		}
+		if len(def.UserAgents) == 0 && len(def.IPRanges) == 0 {
+			return nil, fmt.Errorf("bot definition %s has neither userAgents nor ipRanges", def.Name)
+		}
+		cd := compiledDef{def: def}
+		for _, ua := range def.UserAgents {
+			rx, err := regexp.Compile(ua)
+			if err != nil {
+				return nil, fmt.Errorf("bot definition %s: invalid user agent regexp: %w", def.Name, err)
+			}
+			cd.userAgents = append(cd.userAgents, rx)
+		}
+		for _, rng := range def.IPRanges {
+			prefix, err := common.ParseIPPrefix(rng)
+			if err != nil {
+				return nil, fmt.Errorf("bot definition %s: %w", def.Name, err)
+			}
+			cd.ipRanges = append(cd.ipRanges, prefix)
+		}
+		ans.defs[i] = cd
+	}
+	return ans, nil
+}
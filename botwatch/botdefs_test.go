@@ -0,0 +1,139 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package botwatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+const testDefs = `{
+	"bots": [
+		{
+			"name": "Googlebot",
+			"category": "search",
+			"userAgents": ["(?i)googlebot"],
+			"ipRanges": ["66.249.64.0/19"],
+			"action": "allow"
+		},
+		{
+			"name": "FakeGooglebot",
+			"userAgents": ["(?i)googlebot"],
+			"action": "block"
+		},
+		{
+			"name": "Monitoring",
+			"category": "monitoring",
+			"ipRanges": ["192.0.2.50", "2001:db8::/32"],
+			"action": "ignore"
+		}
+	]
+}`
+
+func newTestMatcher(t *testing.T, clientAddr AddrExtractor) *Matcher {
+	t.Helper()
+	defs, err := ParseBotDefs([]byte(testDefs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMatcher(defs, clientAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMatch(t *testing.T) {
+	m := newTestMatcher(t, nil)
+	if m.NumDefs() != 3 {
+		t.Errorf("expected 3 definitions, got %d", m.NumDefs())
+	}
+	googleUA := "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+	tests := []struct {
+		name      string
+		userAgent string
+		addr      string
+		expected  string
+	}{
+		{name: "user agent and IP range", userAgent: googleUA, addr: "66.249.66.1", expected: "Googlebot"},
+		{name: "IPv4-mapped address", userAgent: googleUA, addr: "::ffff:66.249.66.1", expected: "Googlebot"},
+		{name: "user agent outside of IP range", userAgent: googleUA, addr: "203.0.113.1", expected: "FakeGooglebot"},
+		{name: "single IP address", userAgent: "curl/8.0", addr: "192.0.2.50", expected: "Monitoring"},
+		{name: "IPv6 range", userAgent: "curl/8.0", addr: "2001:db8::1", expected: "Monitoring"},
+		{name: "no match", userAgent: "Mozilla/5.0 (X11; Linux x86_64)", addr: "192.0.2.51", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := m.Match(tt.userAgent, netip.MustParseAddr(tt.addr))
+			var name string
+			if def != nil {
+				name = def.Name
+			}
+			if name != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestMatchRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:54321"
+	req.Header.Set("X-Client-Addr", "192.0.2.50")
+
+	if def := newTestMatcher(t, nil).MatchRequest(req); def != nil {
+		t.Errorf("expected no match for the peer address, got %s", def.Name)
+	}
+	m := newTestMatcher(t, func(req *http.Request) netip.Addr {
+		addr, _ := netip.ParseAddr(req.Header.Get("X-Client-Addr"))
+		return addr
+	})
+	if def := m.MatchRequest(req); def == nil || def.Name != "Monitoring" {
+		t.Errorf("expected Monitoring for the extracted address, got %v", def)
+	}
+}
+
+func TestInvalidDefinitions(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "missing name", data: `{"bots": [{"userAgents": ["foo"], "action": "allow"}]}`},
+		{name: "invalid action", data: `{"bots": [{"name": "foo", "userAgents": ["foo"], "action": "drop"}]}`},
+		{name: "missing criteria", data: `{"bots": [{"name": "foo", "action": "allow"}]}`},
+		{name: "invalid regexp", data: `{"bots": [{"name": "foo", "userAgents": ["(foo"], "action": "allow"}]}`},
+		{name: "invalid IP range", data: `{"bots": [{"name": "foo", "ipRanges": ["300.0.0.0/8"], "action": "allow"}]}`},
+		{name: "short IPv4-mapped range", data: `{"bots": [{"name": "foo", "ipRanges": ["::ffff:0:0/80"], "action": "allow"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs, err := ParseBotDefs([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewMatcher(defs, nil); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+	if _, err := ParseBotDefs([]byte(`{"bots": [`)); err == nil {
+		t.Error("expected a parse error")
+	}
+}
@@ -27,6 +27,10 @@ type Conf struct {
 	// where a list of bots to ignore etc. is defined
 	BotDefsPath string `json:"botDefsPath"`
 
+	// BotDefsReloadIntervalSecs specifies how often BotDefsPath is checked
+	// for changes (see DefsLoader). Zero means a default interval.
+	BotDefsReloadIntervalSecs int `json:"botDefsReloadIntervalSecs"`
+
 	// WatchedTimeWindowSecs specifies a time interval during which IP activies are evaluated.
 	// In other words - each new record is considered along with older records at most as old
 	// as specified by this property
@@ -51,5 +55,8 @@ func (bdc *Conf) Validate(context string) error {
 	if bdc.RSDThreshold == 0 {
 		return fmt.Errorf("%s.rsdThreshold cannot be 0", context)
 	}
+	if bdc.BotDefsReloadIntervalSecs < 0 {
+		return fmt.Errorf("%s.botDefsReloadIntervalSecs cannot be negative", context)
+	}
 	return nil
 }
@@ -0,0 +1,405 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package botwatch
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+)
+
+const (
+	dfltCrawlerCacheTTLSecs         = 3600
+	dfltCrawlerNegativeCacheTTLSecs = 60
+	dfltCrawlerCacheSize            = 50000
+	dfltCrawlerLookupTimeout        = 2000
+)
+
+// Resolver performs DNS lookups needed to verify crawlers.
+// It is satisfied by *net.Resolver (e.g. net.DefaultResolver);
+// tests can provide a local stub.
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// CrawlerDef defines a crawler claimed by its user agent and verified
+// by its DNS domain (e.g. Googlebot with "googlebot.com" and "google.com").
+type CrawlerDef struct {
+	Name string `json:"name"`
+
+	// UserAgents is a list of regular expressions (Go syntax)
+	// identifying requests claiming to be the crawler
+	UserAgents []string `json:"userAgents"`
+
+	// DomainSuffixes lists domains the crawler's hostnames must belong to
+	DomainSuffixes []string `json:"domainSuffixes"`
+}
+
+// CrawlerConf configures verification of crawlers
+type CrawlerConf struct {
+	Crawlers []CrawlerDef `json:"crawlers"`
+
+	// CacheTTLSecs specifies how long verification results are kept
+	CacheTTLSecs int `json:"cacheTtlSecs"`
+
+	// NegativeCacheTTLSecs specifies how long failed verifications
+	// (i.e. DNS errors and timeouts) are kept. Without caching them,
+	// clients claiming to be crawlers could trigger DNS lookups with
+	// each request.
+	NegativeCacheTTLSecs int `json:"negativeCacheTtlSecs"`
+
+	// CacheSize is a maximum number of cached verification results
+	CacheSize int `json:"cacheSize"`
+
+	// LookupTimeoutMs limits duration of all the DNS lookups needed
+	// for a single verification
+	LookupTimeoutMs int `json:"lookupTimeoutMs"`
+}
+
+func (conf *CrawlerConf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	for i, c := range conf.Crawlers {
+		if c.Name == "" {
+			return fmt.Errorf("%s.crawlers[%d].name is missing", context, i)
+		}
+		if len(c.UserAgents) == 0 {
+			return fmt.Errorf("%s.crawlers[%d].userAgents is empty", context, i)
+		}
+		if len(c.DomainSuffixes) == 0 {
+			return fmt.Errorf("%s.crawlers[%d].domainSuffixes is empty", context, i)
+		}
+	}
+	if conf.CacheTTLSecs == 0 {
+		conf.CacheTTLSecs = dfltCrawlerCacheTTLSecs
+	}
+	if conf.NegativeCacheTTLSecs == 0 {
+		conf.NegativeCacheTTLSecs = dfltCrawlerNegativeCacheTTLSecs
+	}
+	if conf.NegativeCacheTTLSecs < 0 {
+		return fmt.Errorf("%s.negativeCacheTtlSecs cannot be negative", context)
+	}
+	if conf.CacheSize == 0 {
+		conf.CacheSize = dfltCrawlerCacheSize
+	}
+	if conf.CacheSize < 0 {
+		return fmt.Errorf("%s.cacheSize cannot be negative", context)
+	}
+	if conf.LookupTimeoutMs == 0 {
+		conf.LookupTimeoutMs = dfltCrawlerLookupTimeout
+	}
+	return nil
+}
+
+// -----
+
+// CrawlerVerification is a result of a crawler verification
+type CrawlerVerification struct {
+
+	// Crawler is a name of the claimed crawler (empty if no crawler is claimed)
+	Crawler string
+
+	// Verified means the client's IP resolves to a hostname in one
+	// of the crawler's domains which resolves back to the IP
+	Verified bool
+
+	// Hostname is the verified hostname
+	Hostname string
+}
+
+// IsClaimed tests whether the request claims to be a known crawler
+func (cv CrawlerVerification) IsClaimed() bool {
+	return cv.Crawler != ""
+}
+
+// IsSpoofed tests whether the request claims to be a crawler
+// but the claim could not be verified
+func (cv CrawlerVerification) IsSpoofed() bool {
+	return cv.IsClaimed() && !cv.Verified
+}
+
+type compiledCrawler struct {
+	def        *CrawlerDef
+	userAgents []*regexp.Regexp
+	suffixes   []string
+}
+
+func (cc *compiledCrawler) claimedBy(userAgent string) bool {
+	for _, rx := range cc.userAgents {
+		if rx.MatchString(userAgent) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cc *compiledCrawler) ownsHost(hostname string) bool {
+	for _, sfx := range cc.suffixes {
+		if hostname == sfx || strings.HasSuffix(hostname, "."+sfx) {
+			return true
+		}
+	}
+	return false
+}
+
+type crawlerCacheItem struct {
+	key     string
+	result  CrawlerVerification
+	err     error
+	expires time.Time
+}
+
+// -----
+
+// CrawlerVerifier recognizes crawlers by their user agents and verifies
+// them using forward-confirmed reverse DNS: the client's IP must resolve
+// to a hostname within the crawler's domains and the hostname must
+// resolve back to the same IP. Results are cached per crawler and IP,
+// the least recently used ones are evicted once the cache is full.
+type CrawlerVerifier struct {
+	conf       *CrawlerConf
+	resolver   Resolver
+	clientAddr AddrExtractor
+	crawlers   []compiledCrawler
+	cache      map[string]*list.Element
+	recency    *list.List
+	mu         sync.Mutex
+}
+
+func (cv *CrawlerVerifier) cacheTTL() time.Duration {
+	return time.Duration(cv.conf.CacheTTLSecs) * time.Second
+}
+
+func (cv *CrawlerVerifier) negativeCacheTTL() time.Duration {
+	return time.Duration(cv.conf.NegativeCacheTTLSecs) * time.Second
+}
+
+func (cv *CrawlerVerifier) getCached(key string, now time.Time) (crawlerCacheItem, bool) {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	elm, ok := cv.cache[key]
+	if !ok {
+		return crawlerCacheItem{}, false
+	}
+	item := elm.Value.(*crawlerCacheItem)
+	if now.After(item.expires) {
+		cv.recency.Remove(elm)
+		delete(cv.cache, key)
+		return crawlerCacheItem{}, false
+	}
+	cv.recency.MoveToFront(elm)
+	return *item, true
+}
+
+// setCached stores a verification result. Failed verifications (err != nil)
+// are kept only for the NegativeCacheTTLSecs. In case the cache is full,
+// the least recently used item is evicted.
+func (cv *CrawlerVerifier) setCached(key string, result CrawlerVerification, err error, now time.Time) {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	ttl := cv.cacheTTL()
+	if err != nil {
+		ttl = cv.negativeCacheTTL()
+	}
+	item := &crawlerCacheItem{key: key, result: result, err: err, expires: now.Add(ttl)}
+	if elm, ok := cv.cache[key]; ok {
+		elm.Value = item
+		cv.recency.MoveToFront(elm)
+		return
+	}
+	if len(cv.cache) >= cv.conf.CacheSize {
+		if oldest := cv.recency.Back(); oldest != nil {
+			cv.recency.Remove(oldest)
+			delete(cv.cache, oldest.Value.(*crawlerCacheItem).key)
+		}
+	}
+	cv.cache[key] = cv.recency.PushFront(item)
+}
+
+// confirmHost performs a forward lookup of the hostname and tests
+// whether it resolves to the address
+func (cv *CrawlerVerifier) confirmHost(
+	ctx context.Context,
+	hostname string,
+	addr netip.Addr,
+) (bool, error) {
+	ips, err := cv.resolver.LookupIPAddr(ctx, hostname)
+	if err != nil {
+		return false, err
+	}
+	for _, ip := range ips {
+		if a, ok := netip.AddrFromSlice(ip.IP); ok && a.Unmap() == addr {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// lookup performs the forward-confirmed reverse DNS lookup
+func (cv *CrawlerVerifier) lookup(
+	ctx context.Context,
+	crawler *compiledCrawler,
+	addr netip.Addr,
+) (CrawlerVerification, error) {
+	ans := CrawlerVerification{Crawler: crawler.def.Name}
+	names, err := cv.resolver.LookupAddr(ctx, addr.String())
+	if isNotFound(err) {
+		return ans, nil
+
+	} else if err != nil {
+		return ans, fmt.Errorf("failed to verify crawler %s at %s: %w", crawler.def.Name, addr, err)
+	}
+	for _, name := range names {
+		hostname := strings.ToLower(strings.TrimSuffix(name, "."))
+		if !crawler.ownsHost(hostname) {
+			continue
+		}
+		ok, err := cv.confirmHost(ctx, hostname, addr)
+		if isNotFound(err) {
+			continue
+
+		} else if err != nil {
+			return ans, fmt.Errorf("failed to verify crawler %s at %s: %w", crawler.def.Name, addr, err)
+		}
+		if ok {
+			ans.Verified = true
+			ans.Hostname = hostname
+			return ans, nil
+		}
+	}
+	return ans, nil
+}
+
+// Verify tests whether the user agent claims to be a known crawler and
+// if so, it verifies the claim. Lookup errors (except for non-existing
+// records) are returned and cached for NegativeCacheTTLSecs so the same
+// error is returned without any lookups until the record expires.
+// Errors caused by ctx itself being canceled or expired (as opposed
+// to the verifier's own LookupTimeoutMs) are not cached as they say
+// nothing about the verified address.
+func (cv *CrawlerVerifier) Verify(
+	ctx context.Context,
+	userAgent string,
+	addr netip.Addr,
+) (CrawlerVerification, error) {
+	var crawler *compiledCrawler
+	for i := range cv.crawlers {
+		if cv.crawlers[i].claimedBy(userAgent) {
+			crawler = &cv.crawlers[i]
+			break
+		}
+	}
+	if crawler == nil {
+		return CrawlerVerification{}, nil
+	}
+	if !addr.IsValid() {
+		return CrawlerVerification{Crawler: crawler.def.Name}, nil
+	}
+	addr = addr.Unmap()
+	now := time.Now()
+	key := crawler.def.Name + "@" + addr.String()
+	if item, ok := cv.getCached(key, now); ok {
+		return item.result, item.err
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, time.Duration(cv.conf.LookupTimeoutMs)*time.Millisecond)
+	defer cancel()
+	result, err := cv.lookup(lookupCtx, crawler, addr)
+	if err != nil && ctx.Err() != nil {
+		return result, err
+	}
+	cv.setCached(key, result, err, now)
+	return result, err
+}
+
+// VerifyRequest verifies a crawler claim of the request. The client
+// address is determined by the verifier's AddrExtractor.
+func (cv *CrawlerVerifier) VerifyRequest(req *http.Request) (CrawlerVerification, error) {
+	return cv.Verify(req.Context(), req.UserAgent(), cv.clientAddr(req))
+}
+
+// IsVerifiedCrawler tests whether the request comes from a verified crawler.
+// Verification errors are treated as "not verified".
+func (cv *CrawlerVerifier) IsVerifiedCrawler(req *http.Request) bool {
+	result, err := cv.VerifyRequest(req)
+	return err == nil && result.Verified
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// CrawlerVerifierWithAddrExtractor sets a function determining client
+// addresses used by VerifyRequest (e.g. guard.ClientAddr). By default,
+// the immediate peer address is used (see common.PeerAddr).
+func CrawlerVerifierWithAddrExtractor(fn AddrExtractor) func(*CrawlerVerifier) {
+	return func(cv *CrawlerVerifier) {
+		cv.clientAddr = fn
+	}
+}
+
+// NewCrawlerVerifier creates a new verifier. In case resolver is nil,
+// net.DefaultResolver is used.
+func NewCrawlerVerifier(
+	conf *CrawlerConf,
+	resolver Resolver,
+	opts ...func(*CrawlerVerifier),
+) (*CrawlerVerifier, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ans := &CrawlerVerifier{
+		conf:       conf,
+		resolver:   resolver,
+		clientAddr: common.PeerAddr,
+		crawlers:   make([]compiledCrawler, len(conf.Crawlers)),
+		cache:      make(map[string]*list.Element),
+		recency:    list.New(),
+	}
+	for _, opt := range opts {
+		opt(ans)
+	}
+	for i := range conf.Crawlers {
+		def := &conf.Crawlers[i]
+		cc := compiledCrawler{def: def}
+		for _, ua := range def.UserAgents {
+			rx, err := regexp.Compile(ua)
+			if err != nil {
+				return nil, fmt.Errorf("crawler %s: invalid user agent regexp: %w", def.Name, err)
+			}
+			cc.userAgents = append(cc.userAgents, rx)
+		}
+		for _, sfx := range def.DomainSuffixes {
+			cc.suffixes = append(cc.suffixes, strings.ToLower(strings.Trim(sfx, ".")))
+		}
+		ans.crawlers[i] = cc
+	}
+	return ans, nil
+}
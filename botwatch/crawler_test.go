@@ -0,0 +1,255 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package botwatch
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubResolver is a Resolver with static PTR and A/AAAA records.
+// Lookups of hosts listed in hang block until the context is done.
+type stubResolver struct {
+	ptr     map[string][]string
+	hosts   map[string][]string
+	hang    map[string]bool
+	lookups int
+	mu      sync.Mutex
+}
+
+func (sr *stubResolver) count() {
+	sr.mu.Lock()
+	sr.lookups++
+	sr.mu.Unlock()
+}
+
+func (sr *stubResolver) numLookups() int {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.lookups
+}
+
+func (sr *stubResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	sr.count()
+	if sr.hang[addr] {
+		<-ctx.Done()
+		return nil, &net.DNSError{Err: ctx.Err().Error(), Name: addr, IsTimeout: true}
+	}
+	names, ok := sr.ptr[addr]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return names, nil
+}
+
+func (sr *stubResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	sr.count()
+	if sr.hang[host] {
+		<-ctx.Done()
+		return nil, &net.DNSError{Err: ctx.Err().Error(), Name: host, IsTimeout: true}
+	}
+	ips, ok := sr.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	ans := make([]net.IPAddr, len(ips))
+	for i, ip := range ips {
+		ans[i] = net.IPAddr{IP: net.ParseIP(ip)}
+	}
+	return ans, nil
+}
+
+func newTestVerifier(t *testing.T, resolver Resolver) *CrawlerVerifier {
+	t.Helper()
+	conf := &CrawlerConf{
+		Crawlers: []CrawlerDef{
+			{
+				Name:           "Googlebot",
+				UserAgents:     []string{"(?i)googlebot"},
+				DomainSuffixes: []string{"googlebot.com", "google.com"},
+			},
+		},
+		LookupTimeoutMs: 20,
+	}
+	if err := conf.ValidateAndDefaults("crawlers"); err != nil {
+		t.Fatal(err)
+	}
+	cv, err := NewCrawlerVerifier(conf, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cv
+}
+
+const googlebotUA = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+
+func TestCrawlerVerification(t *testing.T) {
+	resolver := &stubResolver{
+		ptr: map[string][]string{
+			"66.249.66.1":  {"crawl-66-249-66-1.googlebot.com."},
+			"192.0.2.1":    {"crawler.example.com."},
+			"192.0.2.2":    {"crawl-192-0-2-2.googlebot.com."},
+			"192.0.2.3":    {"crawl-192-0-2-3.googlebot.com."},
+			"192.0.2.4":    {"fakegooglebot.com."},
+			"2001:db8::10": {"crawl.google.com."},
+		},
+		hosts: map[string][]string{
+			"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"},
+			"crawler.example.com":             {"192.0.2.1"},
+			// forward lookup points elsewhere
+			"crawl-192-0-2-2.googlebot.com": {"66.249.66.2"},
+			"fakegooglebot.com":             {"192.0.2.4"},
+			"crawl.google.com":              {"2001:db8::10"},
+		},
+		hang: map[string]bool{
+			"192.0.2.5":                     true,
+			"crawl-192-0-2-3.googlebot.com": true,
+		},
+	}
+	tests := []struct {
+		name      string
+		userAgent string
+		addr      string
+		claimed   bool
+		verified  bool
+		wantErr   bool
+	}{
+		{name: "verified crawler", userAgent: googlebotUA, addr: "66.249.66.1", claimed: true, verified: true},
+		{name: "verified IPv6 crawler", userAgent: googlebotUA, addr: "2001:db8::10", claimed: true, verified: true},
+		{name: "not a crawler", userAgent: "Mozilla/5.0", addr: "192.0.2.1", claimed: false},
+		{name: "PTR outside crawler's domain", userAgent: googlebotUA, addr: "192.0.2.1", claimed: true},
+		{name: "PTR with domain as a mere suffix", userAgent: googlebotUA, addr: "192.0.2.4", claimed: true},
+		{name: "forward lookup mismatch", userAgent: googlebotUA, addr: "192.0.2.2", claimed: true},
+		{name: "NXDOMAIN", userAgent: googlebotUA, addr: "192.0.2.99", claimed: true},
+		{name: "reverse lookup timeout", userAgent: googlebotUA, addr: "192.0.2.5", claimed: true, wantErr: true},
+		{name: "forward lookup timeout", userAgent: googlebotUA, addr: "192.0.2.3", claimed: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cv := newTestVerifier(t, resolver)
+			result, err := cv.Verify(context.Background(), tt.userAgent, netip.MustParseAddr(tt.addr))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result.IsClaimed() != tt.claimed {
+				t.Errorf("IsClaimed() = %v, want %v", result.IsClaimed(), tt.claimed)
+			}
+			if result.Verified != tt.verified {
+				t.Errorf("Verified = %v, want %v", result.Verified, tt.verified)
+			}
+			if tt.claimed && !tt.verified && !result.IsSpoofed() {
+				t.Errorf("unverified claim expected to be reported as spoofed")
+			}
+		})
+	}
+}
+
+func TestCrawlerFailuresAreCached(t *testing.T) {
+	resolver := &stubResolver{hang: map[string]bool{"192.0.2.5": true}}
+	cv := newTestVerifier(t, resolver)
+	addr := netip.MustParseAddr("192.0.2.5")
+	for i := 0; i < 5; i++ {
+		if _, err := cv.Verify(context.Background(), googlebotUA, addr); err == nil {
+			t.Fatalf("expected a lookup error")
+		}
+	}
+	if n := resolver.numLookups(); n != 1 {
+		t.Errorf("number of lookups = %d, want 1", n)
+	}
+}
+
+func TestCrawlerResultsAreCached(t *testing.T) {
+	resolver := &stubResolver{}
+	cv := newTestVerifier(t, resolver)
+	addr := netip.MustParseAddr("192.0.2.99")
+	for i := 0; i < 5; i++ {
+		result, err := cv.Verify(context.Background(), googlebotUA, addr)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result.Verified {
+			t.Fatalf("unexpected verification")
+		}
+	}
+	if n := resolver.numLookups(); n != 1 {
+		t.Errorf("number of lookups = %d, want 1", n)
+	}
+}
+
+func TestCrawlerCallerCancellationIsNotCached(t *testing.T) {
+	resolver := &stubResolver{hang: map[string]bool{"192.0.2.5": true}}
+	cv := newTestVerifier(t, resolver)
+	cv.conf.LookupTimeoutMs = 10000
+	addr := netip.MustParseAddr("192.0.2.5")
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := cv.Verify(ctx, googlebotUA, addr)
+		cancel()
+		if err == nil {
+			t.Fatalf("expected a lookup error")
+		}
+	}
+	if n := resolver.numLookups(); n != 3 {
+		t.Errorf("number of lookups = %d, want 3", n)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cv.Verify(ctx, googlebotUA, addr); err == nil {
+		t.Fatalf("expected a lookup error")
+	}
+	if n := resolver.numLookups(); n != 4 {
+		t.Errorf("number of lookups = %d, want 4", n)
+	}
+}
+
+func TestCrawlerCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	resolver := &stubResolver{}
+	cv := newTestVerifier(t, resolver)
+	cv.conf.CacheSize = 2
+	a := netip.MustParseAddr("192.0.2.97")
+	b := netip.MustParseAddr("192.0.2.98")
+	c := netip.MustParseAddr("192.0.2.99")
+	verify := func(addr netip.Addr) {
+		if _, err := cv.Verify(context.Background(), googlebotUA, addr); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	verify(a)
+	verify(b)
+	verify(a) // a becomes the most recently used item
+	verify(c) // evicts b
+	if n := resolver.numLookups(); n != 3 {
+		t.Fatalf("number of lookups = %d, want 3", n)
+	}
+	if len(cv.cache) != 2 {
+		t.Errorf("cache size = %d, want 2", len(cv.cache))
+	}
+	verify(a)
+	verify(c)
+	if n := resolver.numLookups(); n != 3 {
+		t.Errorf("number of lookups = %d, want 3 (a and c should be cached)", n)
+	}
+	verify(b)
+	if n := resolver.numLookups(); n != 4 {
+		t.Errorf("number of lookups = %d, want 4 (b should be evicted)", n)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package botwatch
+
+import (
+	"container/list"
+	"errors"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	dfltMaxClients = 100000
+	numShards      = 64
+
+	// minSeriesLength is the lowest number of timestamps
+	// an RSD can be reasonably calculated from
+	minSeriesLength = 3
+)
+
+// Verdict describes a client's request series within the watched window
+type Verdict struct {
+	NumRequests  int
+	MeanInterval time.Duration
+
+	// RSD is a relative standard deviation of intervals between requests
+	RSD float64
+
+	IsBotLike bool
+}
+
+// series is a ring buffer of request timestamps (in Unix nanoseconds)
+type series struct {
+	items []int64
+	start int
+	size  int
+}
+
+func (s *series) add(t int64) {
+	if s.size < len(s.items) {
+		s.items[(s.start+s.size)%len(s.items)] = t
+		s.size++
+		return
+	}
+	s.items[s.start] = t
+	s.start = (s.start + 1) % len(s.items)
+}
+
+func (s *series) at(i int) int64 {
+	return s.items[(s.start+i)%len(s.items)]
+}
+
+func (s *series) last() int64 {
+	return s.at(s.size - 1)
+}
+
+// evaluate calculates stats for timestamps newer than windowStart
+func (s *series) evaluate(windowStart int64) Verdict {
+	first := 0
+	for first < s.size && s.at(first) < windowStart {
+		first++
+	}
+	ans := Verdict{NumRequests: s.size - first}
+	if ans.NumRequests < 2 {
+		return ans
+	}
+	numIntervals := float64(ans.NumRequests - 1)
+	var sum float64
+	for i := first + 1; i < s.size; i++ {
+		sum += float64(s.at(i) - s.at(i-1))
+	}
+	mean := sum / numIntervals
+	var sqSum float64
+	for i := first + 1; i < s.size; i++ {
+		d := float64(s.at(i)-s.at(i-1)) - mean
+		sqSum += d * d
+	}
+	ans.MeanInterval = time.Duration(mean)
+	if mean > 0 {
+		ans.RSD = math.Sqrt(sqSum/numIntervals) / mean
+	}
+	return ans
+}
+
+type clientEntry struct {
+	key    string
+	series *series
+}
+
+// shard keeps a part of tracked clients. The recency list contains
+// clients ordered by their latest activity (most recent first)
+// which allows for constant-time eviction.
+type shard struct {
+	clients map[string]*list.Element
+	recency *list.List
+	mu      sync.Mutex
+}
+
+// evictOldest removes the least recently active client.
+// It must be called with the shard lock held.
+func (sh *shard) evictOldest() {
+	oldest := sh.recency.Back()
+	if oldest == nil {
+		return
+	}
+	sh.recency.Remove(oldest)
+	delete(sh.clients, oldest.Value.(*clientEntry).key)
+}
+
+// -----
+
+// KeyExtractor determines a key identifying a client of a request
+// (e.g. guard.ClientIPString). An empty key means the client cannot
+// be identified.
+type KeyExtractor func(req *http.Request) string
+
+// -----
+
+// Detector watches request series of individual clients and flags
+// series with both a high number of requests and regular intervals
+// between them (i.e. RSD below the threshold) as bot-like.
+//
+// For each client, only the latest NumRequestsThreshold timestamps
+// are kept (which is enough to decide) and the number of tracked
+// clients is limited so memory is bounded (roughly by
+// 8 bytes * NumRequestsThreshold * max. number of clients). When the limit
+// is reached, the least recently active client is forgotten. Clients are split
+// into shards, each with its own lock, so the Detector scales well under
+// high concurrency.
+type Detector struct {
+	conf         *Conf
+	window       time.Duration
+	seriesLength int
+	maxPerShard  int
+	shards       [numShards]*shard
+	clientKey    KeyExtractor
+}
+
+func (d *Detector) shardFor(key string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return d.shards[h.Sum32()%numShards]
+}
+
+// Record registers a request of the client made at time t and returns
+// a verdict on the client's current request series.
+func (d *Detector) Record(clientKey string, t time.Time) Verdict {
+	now := t.UnixNano()
+	sh := d.shardFor(clientKey)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	var s *series
+	if elm, ok := sh.clients[clientKey]; ok {
+		s = elm.Value.(*clientEntry).series
+		sh.recency.MoveToFront(elm)
+		// concurrent requests may be recorded slightly out of order
+		now = max(now, s.last())
+
+	} else {
+		for len(sh.clients) >= d.maxPerShard {
+			sh.evictOldest()
+		}
+		s = &series{items: make([]int64, d.seriesLength)}
+		sh.clients[clientKey] = sh.recency.PushFront(&clientEntry{key: clientKey, series: s})
+	}
+	s.add(now)
+	ans := s.evaluate(now - d.window.Nanoseconds())
+	ans.IsBotLike = ans.NumRequests >= d.conf.NumRequestsThreshold &&
+		ans.RSD <= d.conf.RSDThreshold
+	return ans
+}
+
+// NumClients returns number of currently tracked clients
+func (d *Detector) NumClients() int {
+	var ans int
+	for _, sh := range d.shards {
+		sh.mu.Lock()
+		ans += len(sh.clients)
+		sh.mu.Unlock()
+	}
+	return ans
+}
+
+// IsBotLike records the request and tests whether its client is bot-like.
+// Clients are identified by the Detector's KeyExtractor. Requests of clients
+// which cannot be identified are not recorded (and are not considered bot-like).
+// The method makes Detector usable as challenge.Detector.
+func (d *Detector) IsBotLike(req *http.Request) bool {
+	key := d.clientKey(req)
+	if key == "" {
+		return false
+	}
+	return d.Record(key, time.Now()).IsBotLike
+}
+
+// DetectorWithMaxClients sets the maximum number of tracked clients
+func DetectorWithMaxClients(maxClients int) func(*Detector) {
+	return func(d *Detector) {
+		d.maxPerShard = max(maxClients/numShards, 1)
+	}
+}
+
+// NewDetector creates a new bot detector. The conf is expected
+// to be already validated. The clientKey identifies clients of requests
+// (behind a reverse proxy, guard.ClientIPString is a good choice).
+func NewDetector(conf *Conf, clientKey KeyExtractor, opts ...func(*Detector)) (*Detector, error) {
+	if clientKey == nil {
+		return nil, errors.New("failed to create bot detector: missing client key extractor")
+	}
+	ans := &Detector{
+		conf:         conf,
+		window:       time.Duration(conf.WatchedTimeWindowSecs) * time.Second,
+		seriesLength: max(conf.NumRequestsThreshold, minSeriesLength),
+		maxPerShard:  dfltMaxClients / numShards,
+		clientKey:    clientKey,
+	}
+	for i := range ans.shards {
+		ans.shards[i] = &shard{
+			clients: make(map[string]*list.Element),
+			recency: list.New(),
+		}
+	}
+	for _, opt := range opts {
+		opt(ans)
+	}
+	return ans, nil
+}
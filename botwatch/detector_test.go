@@ -0,0 +1,190 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package botwatch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func headerKey(req *http.Request) string {
+	return req.Header.Get("X-Client")
+}
+
+func newTestDetector(t *testing.T, opts ...func(*Detector)) *Detector {
+	t.Helper()
+	conf := &Conf{WatchedTimeWindowSecs: 60, NumRequestsThreshold: 10, RSDThreshold: 0.1}
+	if err := conf.Validate("botwatch"); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDetector(conf, headerKey, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// recordSeries records requests with the specified intervals
+// and returns the last verdict
+func recordSeries(d *Detector, key string, start time.Time, intervals []time.Duration) Verdict {
+	t := start
+	ans := d.Record(key, t)
+	for _, iv := range intervals {
+		t = t.Add(iv)
+		ans = d.Record(key, t)
+	}
+	return ans
+}
+
+func repeatInterval(iv time.Duration, n int) []time.Duration {
+	ans := make([]time.Duration, n)
+	for i := range ans {
+		ans[i] = iv
+	}
+	return ans
+}
+
+func alternating(a, b time.Duration, n int) []time.Duration {
+	ans := make([]time.Duration, n)
+	for i := range ans {
+		if i%2 == 0 {
+			ans[i] = a
+
+		} else {
+			ans[i] = b
+		}
+	}
+	return ans
+}
+
+func TestNewDetectorRequiresClientKey(t *testing.T) {
+	conf := &Conf{WatchedTimeWindowSecs: 60, NumRequestsThreshold: 10, RSDThreshold: 0.1}
+	if _, err := NewDetector(conf, nil); err == nil {
+		t.Error("expected an error for a missing client key extractor")
+	}
+}
+
+func TestRSDThresholds(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	irregular := []time.Duration{
+		time.Second, 3 * time.Second, 500 * time.Millisecond, 4 * time.Second, 2 * time.Second,
+		time.Second, 5 * time.Second, 300 * time.Millisecond, 2 * time.Second, 3 * time.Second,
+	}
+	// the detector keeps the last 10 timestamps, i.e. the last 9 intervals
+	// (5x 1.1s and 4x 0.9s here) with RSD ~ 0.098
+	belowThreshold := alternating(900*time.Millisecond, 1100*time.Millisecond, 10)
+	// RSD ~ 0.147
+	aboveThreshold := alternating(850*time.Millisecond, 1150*time.Millisecond, 10)
+	tests := []struct {
+		name      string
+		intervals []time.Duration
+		botLike   bool
+	}{
+		{name: "regular series", intervals: repeatInterval(time.Second, 9), botLike: true},
+		{name: "too short series", intervals: repeatInterval(time.Second, 8), botLike: false},
+		{name: "irregular series", intervals: irregular, botLike: false},
+		{name: "series just below the RSD threshold", intervals: belowThreshold, botLike: true},
+		{name: "series just above the RSD threshold", intervals: aboveThreshold, botLike: false},
+		{name: "series spanning beyond the window", intervals: repeatInterval(10*time.Second, 9), botLike: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDetector(t)
+			v := recordSeries(d, "client", start, tt.intervals)
+			if v.IsBotLike != tt.botLike {
+				t.Errorf("expected IsBotLike = %v, got %v (requests: %d, RSD: %.3f)",
+					tt.botLike, v.IsBotLike, v.NumRequests, v.RSD)
+			}
+		})
+	}
+}
+
+func TestVerdictStats(t *testing.T) {
+	d := newTestDetector(t)
+	v := recordSeries(d, "client", time.Now(), repeatInterval(2*time.Second, 4))
+	if v.NumRequests != 5 {
+		t.Errorf("expected 5 requests, got %d", v.NumRequests)
+	}
+	if v.MeanInterval != 2*time.Second {
+		t.Errorf("expected mean interval 2s, got %v", v.MeanInterval)
+	}
+	if v.RSD != 0 {
+		t.Errorf("expected RSD 0, got %f", v.RSD)
+	}
+}
+
+func TestMemoryBound(t *testing.T) {
+	d := newTestDetector(t, DetectorWithMaxClients(numShards*4))
+	now := time.Now()
+	for i := 0; i < 10000; i++ {
+		d.Record(fmt.Sprintf("client-%d", i), now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if n := d.NumClients(); n > numShards*4 {
+		t.Errorf("expected at most %d tracked clients, got %d", numShards*4, n)
+	}
+
+	// an active client is kept while inactive ones are evicted
+	d = newTestDetector(t, DetectorWithMaxClients(numShards))
+	for i := 0; i < 1000; i++ {
+		now = now.Add(10 * time.Millisecond)
+		d.Record(fmt.Sprintf("client-%d", i), now)
+		d.Record("active", now)
+	}
+	if v := d.Record("active", now); v.NumRequests != 10 {
+		t.Errorf("expected the active client's series to be kept, got %d requests", v.NumRequests)
+	}
+}
+
+func TestUnidentifiedClients(t *testing.T) {
+	d := newTestDetector(t)
+	for i := 0; i < 20; i++ {
+		if d.IsBotLike(httptest.NewRequest(http.MethodGet, "/", nil)) {
+			t.Fatal("requests without a client key should not be bot-like")
+		}
+	}
+	if n := d.NumClients(); n != 0 {
+		t.Errorf("expected no tracked clients, got %d", n)
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	d := newTestDetector(t, DetectorWithMaxClients(numShards*2))
+	var wg sync.WaitGroup
+	for w := 0; w < 16; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("X-Client", fmt.Sprintf("client-%d", (worker*500+i)%300))
+				d.IsBotLike(req)
+				if i%50 == 0 {
+					d.NumClients()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if n := d.NumClients(); n > numShards*2 {
+		t.Errorf("expected at most %d tracked clients, got %d", numShards*2, n)
+	}
+}
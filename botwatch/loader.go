@@ -0,0 +1,239 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package botwatch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltBotDefsReloadIntervalSecs = 600
+	botDefsHTTPTimeout            = 30 * time.Second
+	maxBotDefsSize                = 10 * 1024 * 1024
+)
+
+func isHTTPPath(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// defsVersion identifies loaded definitions so they are not
+// loaded again in case they have not changed
+type defsVersion struct {
+	fileMtime    time.Time
+	etag         string
+	lastModified string
+}
+
+// DefsLoader loads bot definitions from a local file or an HTTP resource
+// and keeps them up to date. Files are reloaded once their modification
+// time changes, HTTP resources are requested conditionally using ETag
+// (and Last-Modified) so unchanged definitions are not transferred again.
+// In both cases, definitions larger than 10 MiB are rejected.
+type DefsLoader struct {
+	path           string
+	reloadInterval time.Duration
+	client         *http.Client
+	clientAddr     AddrExtractor
+	maxSize        int64
+	matcher        *Matcher
+	mu             sync.RWMutex
+
+	// version describes the currently used definitions. It is updated
+	// only once new definitions are successfully loaded.
+	version defsVersion
+
+	// reloadMu serializes reloading (it guards version)
+	reloadMu sync.Mutex
+}
+
+// fetchFile loads the definitions file in case it has changed.
+// Besides the data, a version of the data is returned.
+func (dl *DefsLoader) fetchFile() ([]byte, defsVersion, bool, error) {
+	info, err := os.Stat(dl.path)
+	if err != nil {
+		return nil, defsVersion{}, false, err
+	}
+	if info.ModTime().Equal(dl.version.fileMtime) {
+		return nil, defsVersion{}, false, nil
+	}
+	if info.Size() > dl.maxSize {
+		return nil, defsVersion{}, false, fmt.Errorf("definitions exceed %d bytes", dl.maxSize)
+	}
+	data, err := os.ReadFile(dl.path)
+	if err != nil {
+		return nil, defsVersion{}, false, err
+	}
+	return data, defsVersion{fileMtime: info.ModTime()}, true, nil
+}
+
+// fetchHTTP loads the definitions resource in case it has changed.
+// Besides the data, a version of the data is returned.
+func (dl *DefsLoader) fetchHTTP(ctx context.Context) ([]byte, defsVersion, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, dl.path, nil)
+	if err != nil {
+		return nil, defsVersion{}, false, err
+	}
+	if dl.version.etag != "" {
+		req.Header.Set("If-None-Match", dl.version.etag)
+	}
+	if dl.version.lastModified != "" {
+		req.Header.Set("If-Modified-Since", dl.version.lastModified)
+	}
+	resp, err := dl.client.Do(req)
+	if err != nil {
+		return nil, defsVersion{}, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, defsVersion{}, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, defsVersion{}, false, fmt.Errorf("unexpected HTTP status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, dl.maxSize+1))
+	if err != nil {
+		return nil, defsVersion{}, false, err
+	}
+	if int64(len(data)) > dl.maxSize {
+		return nil, defsVersion{}, false, fmt.Errorf("definitions exceed %d bytes", dl.maxSize)
+	}
+	ver := defsVersion{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	return data, ver, true, nil
+}
+
+// Reload loads the definitions in case they have changed. The returned
+// value tells whether the definitions have been replaced. In case of an
+// error, the previous definitions are kept and the next reload will
+// try to load the new ones again.
+func (dl *DefsLoader) Reload(ctx context.Context) (bool, error) {
+	dl.reloadMu.Lock()
+	defer dl.reloadMu.Unlock()
+	var data []byte
+	var ver defsVersion
+	var changed bool
+	var err error
+	if isHTTPPath(dl.path) {
+		data, ver, changed, err = dl.fetchHTTP(ctx)
+
+	} else {
+		data, ver, changed, err = dl.fetchFile()
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load bot definitions from %s: %w", dl.path, err)
+	}
+	if !changed {
+		return false, nil
+	}
+	defs, err := ParseBotDefs(data)
+	if err != nil {
+		return false, fmt.Errorf("failed to load bot definitions from %s: %w", dl.path, err)
+	}
+	matcher, err := NewMatcher(defs, dl.clientAddr)
+	if err != nil {
+		return false, fmt.Errorf("failed to load bot definitions from %s: %w", dl.path, err)
+	}
+	dl.mu.Lock()
+	dl.matcher = matcher
+	dl.mu.Unlock()
+	dl.version = ver
+	log.Info().
+		Str("path", dl.path).
+		Int("numDefs", matcher.NumDefs()).
+		Msg("loaded bot definitions")
+	return true, nil
+}
+
+// Run periodically reloads the definitions until the context is cancelled
+func (dl *DefsLoader) Run(ctx context.Context) {
+	ticker := time.NewTicker(dl.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("stopping bot definitions watcher")
+			return
+		case <-ticker.C:
+			if _, err := dl.Reload(ctx); err != nil {
+				log.Error().Err(err).Msg("failed to reload bot definitions, keeping the previous ones")
+			}
+		}
+	}
+}
+
+// Matcher returns the current matcher
+func (dl *DefsLoader) Matcher() *Matcher {
+	dl.mu.RLock()
+	defer dl.mu.RUnlock()
+	return dl.matcher
+}
+
+// Match applies the current definitions (see Matcher.Match)
+func (dl *DefsLoader) Match(userAgent string, addr netip.Addr) *BotDef {
+	return dl.Matcher().Match(userAgent, addr)
+}
+
+// MatchRequest applies the current definitions to the request
+func (dl *DefsLoader) MatchRequest(req *http.Request) *BotDef {
+	return dl.Matcher().MatchRequest(req)
+}
+
+// DefsLoaderWithAddrExtractor sets a function determining client
+// addresses used by MatchRequest (see NewMatcher)
+func DefsLoaderWithAddrExtractor(fn AddrExtractor) func(*DefsLoader) {
+	return func(dl *DefsLoader) {
+		dl.clientAddr = fn
+	}
+}
+
+// NewDefsLoader creates a loader for conf.BotDefsPath and performs
+// the initial load (which must succeed).
+func NewDefsLoader(ctx context.Context, conf *Conf, opts ...func(*DefsLoader)) (*DefsLoader, error) {
+	if conf.BotDefsPath == "" {
+		return nil, fmt.Errorf("failed to create bot definitions loader: botDefsPath not set")
+	}
+	reloadSecs := conf.BotDefsReloadIntervalSecs
+	if reloadSecs == 0 {
+		reloadSecs = dfltBotDefsReloadIntervalSecs
+	}
+	ans := &DefsLoader{
+		path:           conf.BotDefsPath,
+		reloadInterval: time.Duration(reloadSecs) * time.Second,
+		client:         &http.Client{Timeout: botDefsHTTPTimeout},
+		maxSize:        maxBotDefsSize,
+	}
+	for _, opt := range opts {
+		opt(ans)
+	}
+	if _, err := ans.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
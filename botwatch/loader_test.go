@@ -0,0 +1,270 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package botwatch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func defsJSON(names ...string) string {
+	items := make([]string, len(names))
+	for i, name := range names {
+		items[i] = fmt.Sprintf(`{"name": %q, "userAgents": ["(?i)%s"], "action": "allow"}`, name, name)
+	}
+	return `{"bots": [` + strings.Join(items, ", ") + `]}`
+}
+
+// defsServer is a test HTTP server providing bot definitions
+// with optional ETag and Last-Modified validators
+type defsServer struct {
+	body         string
+	etag         string
+	lastModified string
+	requests     []*http.Request
+	mu           sync.Mutex
+}
+
+func (ds *defsServer) set(body, etag, lastModified string) {
+	ds.mu.Lock()
+	ds.body = body
+	ds.etag = etag
+	ds.lastModified = lastModified
+	ds.mu.Unlock()
+}
+
+func (ds *defsServer) lastRequest() *http.Request {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.requests[len(ds.requests)-1]
+}
+
+func (ds *defsServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.requests = append(ds.requests, req)
+	if ds.etag != "" {
+		if req.Header.Get("If-None-Match") == ds.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", ds.etag)
+
+	} else if ds.lastModified != "" {
+		if req.Header.Get("If-Modified-Since") == ds.lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if ds.lastModified != "" {
+		w.Header().Set("Last-Modified", ds.lastModified)
+	}
+	w.Write([]byte(ds.body))
+}
+
+func newHTTPLoader(t *testing.T, ds *defsServer) *DefsLoader {
+	t.Helper()
+	srv := httptest.NewServer(ds)
+	t.Cleanup(srv.Close)
+	dl, err := NewDefsLoader(context.Background(), &Conf{BotDefsPath: srv.URL + "/bots.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dl
+}
+
+func mustReload(t *testing.T, dl *DefsLoader, expChanged bool) {
+	t.Helper()
+	changed, err := dl.Reload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != expChanged {
+		t.Errorf("expected changed = %v, got %v", expChanged, changed)
+	}
+}
+
+func TestHTTPReloadWithETag(t *testing.T) {
+	ds := &defsServer{}
+	ds.set(defsJSON("Googlebot"), `"v1"`, "")
+	dl := newHTTPLoader(t, ds)
+	if dl.Match("Googlebot/2.1", netip.MustParseAddr("192.0.2.1")) == nil {
+		t.Fatal("expected initial definitions to be loaded")
+	}
+
+	mustReload(t, dl, false)
+	if v := ds.lastRequest().Header.Get("If-None-Match"); v != `"v1"` {
+		t.Errorf("expected If-None-Match \"v1\", got %s", v)
+	}
+
+	ds.set(defsJSON("Bingbot"), `"v2"`, "")
+	mustReload(t, dl, true)
+	if dl.Match("bingbot/2.0", netip.MustParseAddr("192.0.2.1")) == nil {
+		t.Error("expected new definitions to be loaded")
+	}
+	mustReload(t, dl, false)
+	if v := ds.lastRequest().Header.Get("If-None-Match"); v != `"v2"` {
+		t.Errorf("expected If-None-Match \"v2\", got %s", v)
+	}
+}
+
+func TestHTTPReloadWithLastModified(t *testing.T) {
+	ds := &defsServer{}
+	v1 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	ds.set(defsJSON("Googlebot"), "", v1)
+	dl := newHTTPLoader(t, ds)
+
+	mustReload(t, dl, false)
+	if v := ds.lastRequest().Header.Get("If-Modified-Since"); v != v1 {
+		t.Errorf("expected If-Modified-Since %s, got %s", v1, v)
+	}
+
+	v2 := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	ds.set(defsJSON("Bingbot"), "", v2)
+	mustReload(t, dl, true)
+	mustReload(t, dl, false)
+	if v := ds.lastRequest().Header.Get("If-Modified-Since"); v != v2 {
+		t.Errorf("expected If-Modified-Since %s, got %s", v2, v)
+	}
+}
+
+func TestHTTPKeepsDefinitionsOnError(t *testing.T) {
+	ds := &defsServer{}
+	ds.set(defsJSON("Googlebot"), `"v1"`, "")
+	dl := newHTTPLoader(t, ds)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "parse error", body: `{"bots": [`},
+		{name: "invalid definition", body: `{"bots": [{"name": "foo", "action": "allow"}]}`},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds.set(tt.body, fmt.Sprintf(`"broken%d"`, i), "")
+			if _, err := dl.Reload(context.Background()); err == nil {
+				t.Fatal("expected a reload error")
+			}
+			if dl.Match("Googlebot/2.1", netip.MustParseAddr("192.0.2.1")) == nil {
+				t.Error("expected the previous definitions to be kept")
+			}
+			// the failed version must not be remembered
+			dl.Reload(context.Background())
+			if v := ds.lastRequest().Header.Get("If-None-Match"); v != `"v1"` {
+				t.Errorf("expected If-None-Match \"v1\", got %s", v)
+			}
+		})
+	}
+}
+
+func TestHTTPUnexpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+	if _, err := NewDefsLoader(context.Background(), &Conf{BotDefsPath: srv.URL}); err == nil {
+		t.Error("expected an error for HTTP 404")
+	}
+}
+
+func TestSizeLimit(t *testing.T) {
+	ds := &defsServer{}
+	ds.set(defsJSON("Googlebot"), `"v1"`, "")
+	dl := newHTTPLoader(t, ds)
+	dl.maxSize = 200
+	ds.set(defsJSON("Bingbot", "Yandexbot", "DuckDuckBot", "Applebot", "Baiduspider"), `"v2"`, "")
+	if _, err := dl.Reload(context.Background()); err == nil {
+		t.Error("expected an error for definitions over the size limit")
+	}
+	if dl.Match("Googlebot/2.1", netip.MustParseAddr("192.0.2.1")) == nil {
+		t.Error("expected the previous definitions to be kept")
+	}
+
+	path := filepath.Join(t.TempDir(), "bots.json")
+	writeDefsFile(t, path, defsJSON("Googlebot"), time.Now())
+	fdl, err := NewDefsLoader(context.Background(), &Conf{BotDefsPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdl.maxSize = 200
+	writeDefsFile(t, path, defsJSON("Bingbot", "Yandexbot", "DuckDuckBot", "Applebot", "Baiduspider"), time.Now().Add(time.Minute))
+	if _, err := fdl.Reload(context.Background()); err == nil {
+		t.Error("expected an error for a file over the size limit")
+	}
+}
+
+func writeDefsFile(t *testing.T, path, data string, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bots.json")
+	t0 := time.Now().Add(-time.Hour)
+	writeDefsFile(t, path, defsJSON("Googlebot"), t0)
+	dl, err := NewDefsLoader(context.Background(), &Conf{BotDefsPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustReload(t, dl, false)
+
+	writeDefsFile(t, path, defsJSON("Bingbot"), t0.Add(time.Minute))
+	mustReload(t, dl, true)
+	if dl.Match("bingbot/2.0", netip.MustParseAddr("192.0.2.1")) == nil {
+		t.Error("expected new definitions to be loaded")
+	}
+	mustReload(t, dl, false)
+
+	// a parse error keeps the previous definitions and the file
+	// is tried again on the next reload
+	writeDefsFile(t, path, `{"bots": [`, t0.Add(2*time.Minute))
+	if _, err := dl.Reload(context.Background()); err == nil {
+		t.Fatal("expected a reload error")
+	}
+	if dl.Match("bingbot/2.0", netip.MustParseAddr("192.0.2.1")) == nil {
+		t.Error("expected the previous definitions to be kept")
+	}
+	if _, err := dl.Reload(context.Background()); err == nil {
+		t.Error("expected the broken file to be loaded again")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dl.Reload(context.Background()); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+	if dl.Match("bingbot/2.0", netip.MustParseAddr("192.0.2.1")) == nil {
+		t.Error("expected the previous definitions to be kept")
+	}
+}
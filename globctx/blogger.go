@@ -26,8 +26,8 @@ import (
 
 	"github.com/czcorpus/apiguard-common/common"
 	"github.com/czcorpus/apiguard-common/reporting"
-
 	"github.com/czcorpus/cnc-gokit/unireq"
+
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -48,10 +48,23 @@ func exportURLArgs(req *http.Request) map[string]any {
 	return ans
 }
 
+// BackendRequestObserver is notified about each logged backend request
+// (e.g. to account processing time).
+type BackendRequestObserver interface {
+	ObserveBackendRequest(bReq *reporting.BackendRequest)
+}
+
 type BackendLogger struct {
 	tDBWriter     reporting.ReportingWriter
 	fileLogger    zerolog.Logger
 	reqPathPrefix string
+	observers     []BackendRequestObserver
+}
+
+// AddObserver registers an observer of logged backend requests.
+// Observers should be added before the logger is used.
+func (b *BackendLogger) AddObserver(obs BackendRequestObserver) {
+	b.observers = append(b.observers, obs)
 }
 
 // Log logs a service backend (e.g. KonText, Treq, some UJC server) access
@@ -80,6 +93,9 @@ func (b *BackendLogger) Log(
 		ActionType:   actionType,
 	}
 	b.tDBWriter.Write(bReq)
+	for _, obs := range b.observers {
+		obs.ObserveBackendRequest(bReq)
+	}
 	// Also log to the custom file logger
 	event := b.fileLogger.Info().
 		Bool("accessLog", true).
@@ -99,6 +115,63 @@ func (b *BackendLogger) Log(
 	event.Send()
 }
 
+// GuardDecision describes a guard decision about a request
+// (typically derived from guard.ReqEvaluation).
+type GuardDecision struct {
+	Guard    string
+	ClientIP string
+	ClientID common.UserID
+	HumanID  common.UserID
+	Status   int
+	Reason   string
+	Err      error
+}
+
+// LogGuardDecision logs a guard decision about a request using
+// the access log and also by sending data to the monitoring module.
+// Decisions allowing the request (status < 400) are not logged.
+func (b *BackendLogger) LogGuardDecision(
+	req *http.Request,
+	service string,
+	decision GuardDecision,
+) {
+	if b == nil {
+		log.Error().Msg("trying to call nil backend logger - ignoring")
+		return
+	}
+	if decision.Status < http.StatusBadRequest && decision.Err == nil {
+		return
+	}
+	report := &reporting.GuardDecisionReport{
+		Created:  time.Now(),
+		Service:  service,
+		Guard:    decision.Guard,
+		ClientIP: decision.ClientIP,
+		ClientID: decision.ClientID,
+		HumanID:  decision.HumanID,
+		Status:   decision.Status,
+		Reason:   decision.Reason,
+	}
+	b.tDBWriter.Write(report)
+	event := b.fileLogger.Info().
+		Bool("accessLog", true).
+		Str("type", "guard").
+		Str("service", report.Service).
+		Str("guard", report.Guard).
+		Int("status", report.Status).
+		Str("reason", report.Reason).
+		Str("ipAddress", report.ClientIP).
+		Str("userAgent", req.UserAgent()).
+		Str("requestPath", strings.TrimPrefix(req.URL.Path, b.reqPathPrefix))
+	if decision.Err != nil {
+		event.Str("error", decision.Err.Error())
+	}
+	if report.HumanID.IsValid() {
+		event.Int("userId", int(report.HumanID))
+	}
+	event.Send()
+}
+
 // NewBackendLogger creates a new backend access logging service
 func NewBackendLogger(
 	tDBWriter reporting.ReportingWriter,
@@ -0,0 +1,261 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apikey provides a guard authenticating requests via API keys
+package apikey
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+)
+
+const (
+	dfltHeaderName      = "X-Api-Key"
+	dfltKeyCacheTTLSecs = 10
+	maxKeyCacheSize     = 10000
+)
+
+var (
+	ErrMissingKey     = errors.New("missing API key")
+	ErrInvalidKey     = errors.New("invalid API key")
+	ErrExpiredKey     = errors.New("expired API key")
+	ErrKeyOutOfScopes = errors.New("API key not valid for the service")
+)
+
+// Conf configures API key authentication. Keys are read either
+// from a JSON file (KeysFilePath) or from the CNC database (DBTable).
+type Conf struct {
+
+	// Service is a name of the protected service used to test key scopes
+	Service string `json:"service"`
+
+	// HeaderName is a request header containing the key.
+	// The "Bearer" prefix is accepted too.
+	HeaderName string `json:"headerName"`
+
+	// QueryParam is an optional URL query argument containing the key
+	QueryParam string `json:"queryParam"`
+
+	KeysFilePath string `json:"keysFilePath"`
+
+	DBTable string `json:"dbTable"`
+
+	// KeyCacheTTLSecs specifies how long looked up keys are cached so
+	// repeated validations of the same key (e.g. by different guards
+	// within a chain) do not hit the store. Please note that it also
+	// delays propagation of key changes. A negative value disables the cache.
+	KeyCacheTTLSecs int `json:"keyCacheTtlSecs"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if conf.Service == "" {
+		return fmt.Errorf("%s.service is missing", context)
+	}
+	if conf.HeaderName == "" {
+		conf.HeaderName = dfltHeaderName
+	}
+	if conf.KeysFilePath != "" && conf.DBTable != "" {
+		return fmt.Errorf("%s: keysFilePath and dbTable cannot be used together", context)
+	}
+	if conf.KeysFilePath == "" && conf.DBTable == "" {
+		return fmt.Errorf("%s: either keysFilePath or dbTable must be set", context)
+	}
+	if conf.KeyCacheTTLSecs == 0 {
+		conf.KeyCacheTTLSecs = dfltKeyCacheTTLSecs
+	}
+	return nil
+}
+
+// -----
+
+type cachedKey struct {
+	rec     *KeyRecord
+	expires time.Time
+}
+
+// Guard authenticates requests using API keys. The key is mapped
+// to a user ID which is used both as ClientID and HumanID.
+type Guard struct {
+	conf           *Conf
+	store          KeyStore
+	anonymousUsers common.AnonymousUsers
+	cache          map[string]cachedKey
+	cacheMu        sync.Mutex
+}
+
+// findKey searches for a key record using the cache (if enabled).
+// Both found and missing keys are cached, store errors are not.
+func (g *Guard) findKey(keyHash string, now time.Time) (*KeyRecord, error) {
+	if g.conf.KeyCacheTTLSecs < 0 {
+		return g.store.FindKey(keyHash)
+	}
+	g.cacheMu.Lock()
+	item, ok := g.cache[keyHash]
+	g.cacheMu.Unlock()
+	if ok && now.Before(item.expires) {
+		return item.rec, nil
+	}
+	rec, err := g.store.FindKey(keyHash)
+	if err != nil {
+		return nil, err
+	}
+	g.cacheMu.Lock()
+	defer g.cacheMu.Unlock()
+	if len(g.cache) >= maxKeyCacheSize {
+		for k, v := range g.cache {
+			if !now.Before(v.expires) {
+				delete(g.cache, k)
+			}
+		}
+	}
+	if len(g.cache) < maxKeyCacheSize {
+		g.cache[keyHash] = cachedKey{
+			rec:     rec,
+			expires: now.Add(time.Duration(g.conf.KeyCacheTTLSecs) * time.Second),
+		}
+	}
+	return rec, nil
+}
+
+func (g *Guard) extractKey(req *http.Request) string {
+	key := strings.TrimSpace(req.Header.Get(g.conf.HeaderName))
+	key = strings.TrimSpace(strings.TrimPrefix(key, "Bearer "))
+	if key == "" && g.conf.QueryParam != "" {
+		key = req.URL.Query().Get(g.conf.QueryParam)
+	}
+	return key
+}
+
+// validate finds and validates an API key of the request
+func (g *Guard) validate(req *http.Request) (*KeyRecord, error) {
+	key := g.extractKey(req)
+	if key == "" {
+		return nil, ErrMissingKey
+	}
+	now := time.Now()
+	rec, err := g.findKey(HashKey(key), now)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, ErrInvalidKey
+	}
+	if rec.IsExpired(now) {
+		return nil, ErrExpiredKey
+	}
+	if !rec.AllowsService(g.conf.Service) {
+		return nil, ErrKeyOutOfScopes
+	}
+	return rec, nil
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	ans := guard.ReqEvaluation{
+		ClientID: common.InvalidUserID,
+		HumanID:  common.InvalidUserID,
+	}
+	rec, err := g.validate(req)
+	switch {
+	case errors.Is(err, ErrMissingKey), errors.Is(err, ErrInvalidKey), errors.Is(err, ErrExpiredKey):
+		ans.ProposedResponse = http.StatusUnauthorized
+		ans.Reason = guard.ReasonUnauthenticated
+		ans.Error = err
+	case errors.Is(err, ErrKeyOutOfScopes):
+		ans.ProposedResponse = http.StatusForbidden
+		ans.Reason = guard.ReasonInsufficientScope
+		ans.Error = err
+	case err != nil:
+		ans.ProposedResponse = http.StatusInternalServerError
+		ans.Reason = guard.ReasonInternalError
+		ans.Error = fmt.Errorf("failed to evaluate API key: %w", err)
+	default:
+		ans.ProposedResponse = http.StatusOK
+		ans.ClientID = rec.UserID
+		ans.HumanID = rec.UserID
+	}
+	return ans
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	return g.anonymousUsers.IsAnonymous(userID)
+}
+
+// DetermineTrueUserID returns a user ID of the request's API key.
+// Requests without a usable key (missing, invalid, expired or out of scopes)
+// are considered anonymous, i.e. common.InvalidUserID without an error
+// is returned. Only store failures are reported as errors.
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	rec, err := g.validate(req)
+	switch {
+	case errors.Is(err, ErrMissingKey), errors.Is(err, ErrInvalidKey),
+		errors.Is(err, ErrExpiredKey), errors.Is(err, ErrKeyOutOfScopes):
+		return common.InvalidUserID, nil
+	case err != nil:
+		return common.InvalidUserID, fmt.Errorf("failed to determine user ID: %w", err)
+	}
+	return rec.UserID, nil
+}
+
+// NewGuard creates a new API key guard. The conf is expected
+// to be already validated (see Conf.ValidateAndDefaults).
+func NewGuard(conf *Conf, store KeyStore, anonymousUsers common.AnonymousUsers) *Guard {
+	return &Guard{
+		conf:           conf,
+		store:          store,
+		anonymousUsers: anonymousUsers,
+		cache:          make(map[string]cachedKey),
+	}
+}
+
+// NewGuardFromConf creates a guard with a key store based on
+// the configuration (the cncDB is used only if keys are stored in a database).
+func NewGuardFromConf(conf *Conf, cncDB *sql.DB, anonymousUsers common.AnonymousUsers) (*Guard, error) {
+	var store KeyStore
+	if conf.KeysFilePath != "" {
+		fStore, err := NewFileStore(conf.KeysFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create API key guard: %w", err)
+		}
+		store = fStore
+
+	} else {
+		if cncDB == nil {
+			return nil, fmt.Errorf("failed to create API key guard: no database available")
+		}
+		store = NewSQLStore(cncDB, conf.DBTable)
+	}
+	return NewGuard(conf, store, anonymousUsers), nil
+}
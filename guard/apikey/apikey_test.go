@@ -0,0 +1,59 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikey
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+)
+
+type stubStore map[string]*KeyRecord
+
+func (s stubStore) FindKey(keyHash string) (*KeyRecord, error) {
+	return s[keyHash], nil
+}
+
+func TestConformance(t *testing.T) {
+	conf := &Conf{Service: "kontext", KeysFilePath: "unused.json"}
+	if err := conf.ValidateAndDefaults("apikey"); err != nil {
+		t.Fatal(err)
+	}
+	store := stubStore{
+		HashKey("valid-key"): {KeyHash: HashKey("valid-key"), UserID: 42},
+	}
+	fixtures := append(
+		guardtest.DefaultFixtures(),
+		guardtest.Fixture{
+			Name: "client with valid API key",
+			NewRequest: func() *http.Request {
+				req := guardtest.NewRequest("/api/query", "192.0.2.20")
+				req.Header.Set(conf.HeaderName, "valid-key")
+				return req
+			},
+		},
+	)
+	anonymousUsers := common.AnonymousUsers{0, 1}
+	guardtest.Run(t, guardtest.Suite{
+		Guard:          NewGuard(conf, store, anonymousUsers),
+		AnonymousUsers: anonymousUsers,
+		Fixtures:       fixtures,
+	})
+}
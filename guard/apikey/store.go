@@ -0,0 +1,167 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikey
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+)
+
+// HashKey produces a hash of an API key as expected by key stores
+// (hex encoded SHA-256)
+func HashKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// KeyRecord describes a single API key
+type KeyRecord struct {
+
+	// KeyHash is a hex encoded SHA-256 of the key (see HashKey)
+	KeyHash string `json:"keyHash"`
+
+	UserID common.UserID `json:"userId"`
+
+	// Scopes lists services the key can be used for.
+	// An empty list means all the services.
+	Scopes []string `json:"scopes"`
+
+	// Expires is an optional expiration time of the key
+	Expires *time.Time `json:"expires"`
+}
+
+func (kr *KeyRecord) IsExpired(t time.Time) bool {
+	return kr.Expires != nil && !t.Before(*kr.Expires)
+}
+
+func (kr *KeyRecord) AllowsService(service string) bool {
+	return len(kr.Scopes) == 0 || slices.Contains(kr.Scopes, service)
+}
+
+// -----
+
+// KeyStore provides access to API keys
+type KeyStore interface {
+
+	// FindKey searches for a key record by its hash.
+	// In case the key does not exist, nil and no error is returned.
+	FindKey(keyHash string) (*KeyRecord, error)
+}
+
+// -----
+
+// FileStore is a KeyStore loading keys from a JSON file
+// containing a list of KeyRecord items.
+type FileStore struct {
+	path string
+	keys map[string]*KeyRecord
+	mu   sync.RWMutex
+}
+
+// Reload loads the key file again. In case of an error,
+// the previous keys are kept.
+func (fs *FileStore) Reload() error {
+	data, err := os.ReadFile(fs.path)
+	if err != nil {
+		return fmt.Errorf("failed to load API keys from %s: %w", fs.path, err)
+	}
+	var records []*KeyRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed to load API keys from %s: %w", fs.path, err)
+	}
+	keys := make(map[string]*KeyRecord)
+	for i, rec := range records {
+		if rec.KeyHash == "" {
+			return fmt.Errorf("failed to load API keys from %s: item %d has no keyHash", fs.path, i)
+		}
+		keys[strings.ToLower(rec.KeyHash)] = rec
+	}
+	fs.mu.Lock()
+	fs.keys = keys
+	fs.mu.Unlock()
+	return nil
+}
+
+func (fs *FileStore) FindKey(keyHash string) (*KeyRecord, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.keys[keyHash], nil
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	ans := &FileStore{path: path}
+	if err := ans.Reload(); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// -----
+
+// SQLStore is a KeyStore using an SQL database (typically the CNC DB).
+// The table is expected to contain columns:
+// key_hash (hex SHA-256), user_id (int), scopes (comma-separated service names
+// or NULL) and expires (datetime or NULL).
+type SQLStore struct {
+	db        *sql.DB
+	tableName string
+}
+
+func (ss *SQLStore) FindKey(keyHash string) (*KeyRecord, error) {
+	row := ss.db.QueryRow(
+		fmt.Sprintf("SELECT user_id, scopes, expires FROM %s WHERE key_hash = ?", ss.tableName),
+		keyHash,
+	)
+	var userID int
+	var scopes sql.NullString
+	var expires sql.NullTime
+	if err := row.Scan(&userID, &scopes, &expires); errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to find API key: %w", err)
+	}
+	ans := &KeyRecord{
+		KeyHash: keyHash,
+		UserID:  common.UserID(userID),
+	}
+	if scopes.Valid && scopes.String != "" {
+		for _, s := range strings.Split(scopes.String, ",") {
+			ans.Scopes = append(ans.Scopes, strings.TrimSpace(s))
+		}
+	}
+	if expires.Valid {
+		ans.Expires = &expires.Time
+	}
+	return ans, nil
+}
+
+func NewSQLStore(db *sql.DB, tableName string) *SQLStore {
+	return &SQLStore{db: db, tableName: tableName}
+}
@@ -0,0 +1,338 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ban provides temporary bans with escalation for repeated offenses
+package ban
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/guard/iplist"
+	"github.com/czcorpus/apiguard-common/reporting"
+	"github.com/czcorpus/apiguard-common/telemetry"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltBaseDurationSecs     = 600
+	dfltEscalationFactor     = 2.0
+	dfltMaxDurationSecs      = 30 * 24 * 3600
+	dfltEscalationWindowSecs = 30 * 24 * 3600
+
+	// prefixIndexRefreshInterval specifies how often the prefix ban index
+	// is rebuilt to reflect bans added to the store by other instances
+	prefixIndexRefreshInterval = 30 * time.Second
+)
+
+// Conf configures ban durations. A ban duration is calculated as
+// BaseDurationSecs * EscalationFactor^N where N is the number of
+// previous bans of the same target within EscalationWindowSecs.
+type Conf struct {
+	BaseDurationSecs     int     `json:"baseDurationSecs"`
+	EscalationFactor     float64 `json:"escalationFactor"`
+	MaxDurationSecs      int     `json:"maxDurationSecs"`
+	EscalationWindowSecs int     `json:"escalationWindowSecs"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if conf.BaseDurationSecs == 0 {
+		conf.BaseDurationSecs = dfltBaseDurationSecs
+	}
+	if conf.EscalationFactor == 0 {
+		conf.EscalationFactor = dfltEscalationFactor
+	}
+	if conf.EscalationFactor < 1 {
+		return fmt.Errorf("%s.escalationFactor must be >= 1", context)
+	}
+	if conf.MaxDurationSecs == 0 {
+		conf.MaxDurationSecs = dfltMaxDurationSecs
+	}
+	if conf.MaxDurationSecs < conf.BaseDurationSecs {
+		return fmt.Errorf("%s.maxDurationSecs cannot be lower than %s.baseDurationSecs", context, context)
+	}
+	if conf.EscalationWindowSecs == 0 {
+		conf.EscalationWindowSecs = dfltEscalationWindowSecs
+	}
+	return nil
+}
+
+func (conf *Conf) escalationWindow() time.Duration {
+	return time.Duration(conf.EscalationWindowSecs) * time.Second
+}
+
+// -----
+
+// prefixIndex is a snapshot of active prefix bans allowing
+// for fast IP tests.
+type prefixIndex struct {
+	trie *iplist.PrefixTrie
+	bans []Ban
+
+	// expires is the time the index must be rebuilt (either because
+	// of the refresh interval or because some of the bans expires)
+	expires time.Time
+}
+
+func (idx *prefixIndex) find(addr netip.Addr) *Ban {
+	if !idx.trie.Contains(addr) {
+		return nil
+	}
+	for _, b := range idx.bans {
+		if prefix, err := netip.ParsePrefix(b.Target.Value); err == nil && prefix.Contains(addr) {
+			return &b
+		}
+	}
+	return nil
+}
+
+func newPrefixIndex(bans []Ban, now time.Time) *prefixIndex {
+	ans := &prefixIndex{
+		trie:    iplist.NewPrefixTrie(),
+		expires: now.Add(prefixIndexRefreshInterval),
+	}
+	for _, b := range bans {
+		if b.Target.Type != TargetPrefix {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(b.Target.Value)
+		if err != nil {
+			log.Warn().Str("target", b.Target.String()).Msg("ignoring invalid prefix ban")
+			continue
+		}
+		ans.trie.Insert(prefix)
+		ans.bans = append(ans.bans, b)
+		if b.Until.Before(ans.expires) {
+			ans.expires = b.Until
+		}
+	}
+	return ans
+}
+
+// -----
+
+// Manager handles lifecycle of bans. Bans are kept in a Store.
+// Optionally, a telemetry.Storage can be attached in which case
+// its IP bans are respected too and its ban history is considered
+// for escalation.
+type Manager struct {
+	conf            *Conf
+	store           Store
+	telemetryDB     telemetry.Storage
+	reportingWriter reporting.ReportingWriter
+
+	// prefixIdx is a lazily (re)built index of prefix bans so
+	// the store is not listed for each request
+	prefixIdx *prefixIndex
+	prefixMu  sync.Mutex
+}
+
+func (m *Manager) prefixBans(now time.Time) (*prefixIndex, error) {
+	m.prefixMu.Lock()
+	defer m.prefixMu.Unlock()
+	if m.prefixIdx != nil && now.Before(m.prefixIdx.expires) {
+		return m.prefixIdx, nil
+	}
+	bans, err := m.store.ActiveBans(now)
+	if err != nil {
+		return nil, err
+	}
+	m.prefixIdx = newPrefixIndex(bans, now)
+	return m.prefixIdx, nil
+}
+
+func (m *Manager) invalidatePrefixBans() {
+	m.prefixMu.Lock()
+	m.prefixIdx = nil
+	m.prefixMu.Unlock()
+}
+
+func (m *Manager) report(action string, ban Ban, now time.Time) {
+	if m.reportingWriter == nil {
+		return
+	}
+	m.reportingWriter.Write(&reporting.BanReport{
+		Created:    now,
+		Action:     action,
+		TargetType: string(ban.Target.Type),
+		Target:     ban.Target.Value,
+		Until:      ban.Until,
+		Level:      ban.Level,
+		Reason:     ban.Reason,
+	})
+}
+
+func (m *Manager) numOffenses(target Target, now time.Time) (int, error) {
+	num, err := m.store.NumOffenses(target, now.Add(-m.conf.escalationWindow()))
+	if err != nil {
+		return 0, err
+	}
+	if m.telemetryDB != nil && target.Type == TargetIP {
+		rows, err := m.telemetryDB.AnalyzeBans(m.conf.escalationWindow())
+		if err != nil {
+			return 0, err
+		}
+		for _, row := range rows {
+			if row.ClientIP == target.Value {
+				num = max(num, row.Bans)
+				break
+			}
+		}
+	}
+	return num, nil
+}
+
+// BanDuration calculates a ban duration for a specified escalation level
+func (m *Manager) BanDuration(level int) time.Duration {
+	secs := float64(m.conf.BaseDurationSecs) * math.Pow(m.conf.EscalationFactor, float64(level))
+	secs = min(secs, float64(m.conf.MaxDurationSecs))
+	return time.Duration(secs * float64(time.Second))
+}
+
+// Ban bans the target. The duration is escalated based on the number
+// of the target's previous bans. In case the target is already banned,
+// the ban is replaced by a new (escalated) one.
+func (m *Manager) Ban(target Target, reason string) (Ban, error) {
+	target, err := target.Validate()
+	if err != nil {
+		return Ban{}, err
+	}
+	now := time.Now()
+	level, err := m.numOffenses(target, now)
+	if err != nil {
+		return Ban{}, fmt.Errorf("failed to ban %s: %w", target, err)
+	}
+	ban := Ban{
+		Target:  target,
+		Created: now,
+		Until:   now.Add(m.BanDuration(level)),
+		Level:   level,
+		Reason:  reason,
+	}
+	if err := m.store.AddBan(ban); err != nil {
+		return Ban{}, fmt.Errorf("failed to ban %s: %w", target, err)
+	}
+	if target.Type == TargetPrefix {
+		m.invalidatePrefixBans()
+	}
+	log.Info().
+		Str("target", target.String()).
+		Time("until", ban.Until).
+		Int("banLevel", level).
+		Str("reason", reason).
+		Msg("banned")
+	m.report(reporting.BanActionBan, ban, now)
+	return ban, nil
+}
+
+// Unban lifts an active ban of the target. The returned value
+// tells whether there was an active ban.
+func (m *Manager) Unban(target Target) (bool, error) {
+	target, err := target.Validate()
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	removed, err := m.store.RemoveBan(target, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to unban %s: %w", target, err)
+	}
+	if target.Type == TargetPrefix {
+		m.invalidatePrefixBans()
+	}
+	if removed {
+		log.Info().Str("target", target.String()).Msg("unbanned")
+		m.report(reporting.BanActionUnban, Ban{Target: target, Until: now}, now)
+	}
+	return removed, nil
+}
+
+// ActiveBans lists all the currently active bans managed by the Manager
+// (i.e. bans stored only in the telemetry.Storage are not included)
+func (m *Manager) ActiveBans() ([]Ban, error) {
+	return m.store.ActiveBans(time.Now())
+}
+
+// FindBan searches for an active ban applicable to the IP address
+// or the session (which can be empty). The IP is tested against both
+// IP and prefix bans. Prefix bans are tested using an index which is
+// rebuilt on changes made by the Manager and periodically (to reflect
+// changes made to a shared store by other instances).
+func (m *Manager) FindBan(addr netip.Addr, sessionID string) (*Ban, error) {
+	now := time.Now()
+	if sessionID != "" {
+		ban, err := m.store.FindActive(Target{Type: TargetSession, Value: sessionID}, now)
+		if err != nil || ban != nil {
+			return ban, err
+		}
+	}
+	if !addr.IsValid() {
+		return nil, nil
+	}
+	addr = addr.Unmap()
+	ban, err := m.store.FindActive(Target{Type: TargetIP, Value: addr.String()}, now)
+	if err != nil || ban != nil {
+		return ban, err
+	}
+	prefixes, err := m.prefixBans(now)
+	if err != nil {
+		return nil, err
+	}
+	if ban := prefixes.find(addr); ban != nil {
+		return ban, nil
+	}
+	if m.telemetryDB != nil {
+		banned, err := m.telemetryDB.TestIPBan(net.IP(addr.AsSlice()))
+		if err != nil {
+			return nil, err
+		}
+		if banned {
+			// we don't know details about external bans
+			return &Ban{
+				Target: Target{Type: TargetIP, Value: addr.String()},
+				Reason: "telemetry storage ban",
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// NewManager creates a new ban manager. In case store is nil, a MemoryStore
+// is used. Both telemetryDB and reportingWriter are optional.
+func NewManager(
+	conf *Conf,
+	store Store,
+	telemetryDB telemetry.Storage,
+	reportingWriter reporting.ReportingWriter,
+) *Manager {
+	if store == nil {
+		store = NewMemoryStore(conf.escalationWindow())
+	}
+	return &Manager{
+		conf:            conf,
+		store:           store,
+		telemetryDB:     telemetryDB,
+		reportingWriter: reportingWriter,
+	}
+}
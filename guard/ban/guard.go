@@ -0,0 +1,108 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ban
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/session"
+	"github.com/czcorpus/apiguard-common/logging"
+)
+
+// GuardWithSessionCookie sets a name of the session cookie
+// (logging.WaGSessionName by default). It should match the cookie
+// name used by the session guard.
+func GuardWithSessionCookie(name string) func(*Guard) {
+	return func(g *Guard) {
+		g.sessionCookie = name
+	}
+}
+
+// Guard rejects requests from banned IP addresses, networks and sessions.
+// Sessions are identified by session IDs from session.Guard cookies. The guard
+// does not validate the cookies (and it does not set ReqEvaluation.SessionID)
+// so it should be combined with session.Guard.
+type Guard struct {
+	manager       *Manager
+	sessionCookie string
+}
+
+func (g *Guard) sessionID(req *http.Request) string {
+	cookie, err := req.Cookie(g.sessionCookie)
+	if err != nil {
+		return ""
+	}
+	return session.SessionIDFromCookie(cookie.Value)
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	ans := guard.ReqEvaluation{
+		ClientID:         common.InvalidUserID,
+		HumanID:          common.InvalidUserID,
+		ProposedResponse: http.StatusOK,
+	}
+	ban, err := g.manager.FindBan(guard.ClientAddr(req), g.sessionID(req))
+	if err != nil {
+		ans.ProposedResponse = http.StatusInternalServerError
+		ans.Reason = guard.ReasonInternalError
+		ans.Error = fmt.Errorf("failed to test bans: %w", err)
+		return ans
+	}
+	if ban != nil {
+		ans.ProposedResponse = http.StatusForbidden
+		ans.Reason = guard.ReasonBannedIP
+		if ban.Target.Type == TargetSession {
+			ans.Reason = guard.ReasonBannedSession
+		}
+		if !ban.Until.IsZero() {
+			ans.RetryAfter = time.Until(ban.Until)
+		}
+	}
+	return ans
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	return false
+}
+
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	return common.InvalidUserID, nil
+}
+
+func NewGuard(manager *Manager, opts ...func(*Guard)) *Guard {
+	ans := &Guard{
+		manager:       manager,
+		sessionCookie: logging.WaGSessionName,
+	}
+	for _, opt := range opts {
+		opt(ans)
+	}
+	return ans
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ban
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+	"github.com/czcorpus/apiguard-common/logging"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	conf := &Conf{}
+	if err := conf.ValidateAndDefaults("ban"); err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(conf, nil, nil, nil)
+}
+
+func TestConformance(t *testing.T) {
+	guardtest.Run(t, guardtest.Suite{Guard: NewGuard(newTestManager(t))})
+}
+
+func TestPrefixBan(t *testing.T) {
+	manager := newTestManager(t)
+	g := NewGuard(manager)
+	target := Target{Type: TargetPrefix, Value: "::ffff:198.51.100.0/120"}
+	ban, err := manager.Ban(target, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ban.Target.Value != "198.51.100.0/24" {
+		t.Errorf("expected normalized prefix 198.51.100.0/24, got %s", ban.Target.Value)
+	}
+	eval := g.EvaluateRequest(guardtest.NewRequest("/", "198.51.100.7"), nil)
+	if eval.ProposedResponse != http.StatusForbidden || eval.Reason != guard.ReasonBannedIP {
+		t.Errorf("expected 403 banned IP, got %d (%s)", eval.ProposedResponse, eval.Reason)
+	}
+	if eval.RetryAfter <= 0 {
+		t.Error("expected RetryAfter for a banned client")
+	}
+	eval = g.EvaluateRequest(guardtest.NewRequest("/", "198.51.101.7"), nil)
+	if eval.ProposedResponse != http.StatusOK {
+		t.Errorf("expected 200 outside of the banned prefix, got %d", eval.ProposedResponse)
+	}
+	if _, err := manager.Unban(target); err != nil {
+		t.Fatal(err)
+	}
+	eval = g.EvaluateRequest(guardtest.NewRequest("/", "198.51.100.7"), nil)
+	if eval.ProposedResponse != http.StatusOK {
+		t.Errorf("expected 200 after unban, got %d", eval.ProposedResponse)
+	}
+}
+
+func TestSessionBan(t *testing.T) {
+	manager := newTestManager(t)
+	g := NewGuard(manager)
+	if _, err := manager.Ban(Target{Type: TargetSession, Value: "sessionA"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		cookie    string
+		expStatus int
+	}{
+		{name: "banned session", cookie: "sessionA.kx2f1c.tag.mac", expStatus: http.StatusForbidden},
+		{name: "other session", cookie: "sessionB.kx2f1c.tag.mac", expStatus: http.StatusOK},
+		{name: "raw cookie value", cookie: "sessionA", expStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := guardtest.NewRequest("/", "192.0.2.10")
+			req.AddCookie(&http.Cookie{Name: logging.WaGSessionName, Value: tt.cookie})
+			eval := g.EvaluateRequest(req, nil)
+			if eval.ProposedResponse != tt.expStatus {
+				t.Errorf("expected status %d, got %d", tt.expStatus, eval.ProposedResponse)
+			}
+			if eval.SessionID != "" {
+				t.Errorf("ban guard should not set SessionID, got %s", eval.SessionID)
+			}
+		})
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	conf := &Conf{BaseDurationSecs: 60, EscalationFactor: 3, MaxDurationSecs: 1000}
+	if err := conf.ValidateAndDefaults("ban"); err != nil {
+		t.Fatal(err)
+	}
+	manager := NewManager(conf, nil, nil, nil)
+	target := Target{Type: TargetIP, Value: "192.0.2.10"}
+	expected := []struct {
+		level    int
+		duration time.Duration
+	}{
+		{level: 0, duration: 60 * time.Second},
+		{level: 1, duration: 180 * time.Second},
+		{level: 2, duration: 540 * time.Second},
+		{level: 3, duration: 1000 * time.Second}, // capped by maxDurationSecs
+	}
+	for _, exp := range expected {
+		ban, err := manager.Ban(target, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ban.Level != exp.level {
+			t.Errorf("expected ban level %d, got %d", exp.level, ban.Level)
+		}
+		if d := ban.Until.Sub(ban.Created); d != exp.duration {
+			t.Errorf("expected ban duration %v at level %d, got %v", exp.duration, exp.level, d)
+		}
+		// an unban does not reset the escalation
+		if _, err := manager.Unban(target); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// other targets are not affected
+	ban, err := manager.Ban(Target{Type: TargetIP, Value: "192.0.2.11"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ban.Level != 0 {
+		t.Errorf("expected level 0 for a new target, got %d", ban.Level)
+	}
+}
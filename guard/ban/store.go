@@ -0,0 +1,209 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ban
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+)
+
+const (
+	TargetIP      TargetType = "ip"
+	TargetPrefix  TargetType = "prefix"
+	TargetSession TargetType = "session"
+
+	historyPruneInterval = time.Hour
+)
+
+// TargetType specifies what is banned
+type TargetType string
+
+// Target is a banned entity - an IP address, a network prefix
+// or a session ID
+type Target struct {
+	Type  TargetType `json:"type"`
+	Value string     `json:"value"`
+}
+
+func (t Target) String() string {
+	return fmt.Sprintf("%s:%s", t.Type, t.Value)
+}
+
+// Validate tests the target value and normalizes it
+// (e.g. prefixes are masked)
+func (t Target) Validate() (Target, error) {
+	switch t.Type {
+	case TargetIP:
+		addr, err := netip.ParseAddr(t.Value)
+		if err != nil {
+			return t, fmt.Errorf("invalid ban target %s: %w", t, err)
+		}
+		return Target{Type: t.Type, Value: addr.Unmap().String()}, nil
+	case TargetPrefix:
+		prefix, err := common.ParseIPPrefix(t.Value)
+		if err != nil {
+			return t, fmt.Errorf("invalid ban target %s: %w", t, err)
+		}
+		return Target{Type: t.Type, Value: prefix.String()}, nil
+	case TargetSession:
+		if t.Value == "" {
+			return t, fmt.Errorf("invalid ban target %s: empty session", t)
+		}
+		return t, nil
+	}
+	return t, fmt.Errorf("invalid ban target type: %s", t.Type)
+}
+
+// Ban is a single (active or past) ban record
+type Ban struct {
+	Target  Target    `json:"target"`
+	Created time.Time `json:"created"`
+	Until   time.Time `json:"until"`
+
+	// Level is 0 for the first offense and it is
+	// incremented for each repeated one
+	Level int `json:"level"`
+
+	Reason string `json:"reason"`
+}
+
+func (b Ban) IsActive(t time.Time) bool {
+	return t.Before(b.Until)
+}
+
+// -----
+
+// Store keeps bans and offense history
+type Store interface {
+	AddBan(ban Ban) error
+
+	// RemoveBan lifts an active ban of the target (if any).
+	// The ban is kept in the offense history.
+	RemoveBan(target Target, now time.Time) (bool, error)
+
+	FindActive(target Target, now time.Time) (*Ban, error)
+
+	ActiveBans(now time.Time) ([]Ban, error)
+
+	// NumOffenses returns number of bans of the target created after `since`
+	NumOffenses(target Target, since time.Time) (int, error)
+}
+
+// -----
+
+// MemoryStore is an in-memory implementation of Store.
+// Offense history older than historyTTL is periodically removed.
+type MemoryStore struct {
+	active     map[Target]Ban
+	history    map[Target][]time.Time
+	historyTTL time.Duration
+	lastPrune  time.Time
+	mu         sync.Mutex
+}
+
+func (ms *MemoryStore) pruneHistory(now time.Time) {
+	since := now.Add(-ms.historyTTL)
+	for k, items := range ms.history {
+		items = slices.DeleteFunc(items, func(t time.Time) bool { return t.Before(since) })
+		if len(items) == 0 {
+			delete(ms.history, k)
+
+		} else {
+			ms.history[k] = items
+		}
+	}
+	ms.lastPrune = now
+}
+
+func (ms *MemoryStore) AddBan(ban Ban) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ban.Created.Sub(ms.lastPrune) > historyPruneInterval {
+		ms.pruneHistory(ban.Created)
+	}
+	ms.active[ban.Target] = ban
+	ms.history[ban.Target] = append(ms.history[ban.Target], ban.Created)
+	return nil
+}
+
+func (ms *MemoryStore) RemoveBan(target Target, now time.Time) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	b, ok := ms.active[target]
+	delete(ms.active, target)
+	return ok && b.IsActive(now), nil
+}
+
+func (ms *MemoryStore) FindActive(target Target, now time.Time) (*Ban, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	b, ok := ms.active[target]
+	if !ok {
+		return nil, nil
+	}
+	if !b.IsActive(now) {
+		delete(ms.active, target)
+		return nil, nil
+	}
+	return &b, nil
+}
+
+func (ms *MemoryStore) ActiveBans(now time.Time) ([]Ban, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ans := make([]Ban, 0, len(ms.active))
+	for k, b := range ms.active {
+		if b.IsActive(now) {
+			ans = append(ans, b)
+
+		} else {
+			delete(ms.active, k)
+		}
+	}
+	slices.SortFunc(ans, func(a, b Ban) int { return a.Until.Compare(b.Until) })
+	return ans, nil
+}
+
+func (ms *MemoryStore) NumOffenses(target Target, since time.Time) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	items := ms.history[target]
+	// we use the opportunity to remove old history
+	items = slices.DeleteFunc(items, func(t time.Time) bool { return t.Before(since) })
+	if len(items) == 0 {
+		delete(ms.history, target)
+
+	} else {
+		ms.history[target] = items
+	}
+	return len(items), nil
+}
+
+func NewMemoryStore(historyTTL time.Duration) *MemoryStore {
+	return &MemoryStore{
+		active:     make(map[Target]Ban),
+		history:    make(map[Target][]time.Time),
+		historyTTL: historyTTL,
+		lastPrune:  time.Now(),
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+)
+
+const (
+	DelayCombinationMax DelayCombination = "max"
+	DelayCombinationSum DelayCombination = "sum"
+)
+
+// DelayCombination specifies how Chain combines delays
+// calculated by its sub-guards
+type DelayCombination string
+
+func (dc DelayCombination) Validate() error {
+	if dc != DelayCombinationMax && dc != DelayCombinationSum {
+		return fmt.Errorf("invalid delay combination: %s", dc)
+	}
+	return nil
+}
+
+// ChainItem is a named guard within a Chain
+type ChainItem struct {
+	Name  string
+	Guard ServiceGuard
+}
+
+// Bypasser is an optional interface a guard within a Chain
+// may implement to exempt a request (e.g. an allowlisted client)
+// from evaluation by the remaining guards.
+type Bypasser interface {
+	BypassesChain(req *http.Request) bool
+}
+
+func bypasses(g ServiceGuard, req *http.Request) bool {
+	b, ok := g.(Bypasser)
+	return ok && b.BypassesChain(req)
+}
+
+// Chain is a composite ServiceGuard running its sub-guards in order.
+// The evaluation stops at the first sub-guard which rejects the request
+// (or fails). Identifiers (ClientID, HumanID, SessionID) are merged so
+// that the first valid value provided by a sub-guard wins.
+type Chain struct {
+	items            []ChainItem
+	delayCombination DelayCombination
+}
+
+// CalcDelay combines delays of all the sub-guards
+// based on the configured DelayCombination. Sub-guards following
+// a bypassing guard (see Bypasser) are not considered.
+func (ch *Chain) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	var ans time.Duration
+	for _, item := range ch.items {
+		if bypasses(item.Guard, req) {
+			break
+		}
+		delay, err := item.Guard.CalcDelay(req, clientID)
+		if err != nil {
+			return 0, fmt.Errorf("guard %s failed to calculate delay: %w", item.Name, err)
+		}
+		switch ch.delayCombination {
+		case DelayCombinationSum:
+			ans += delay
+		default:
+			ans = max(ans, delay)
+		}
+	}
+	return ans, nil
+}
+
+// LogAppliedDelay passes the information to all the sub-guards
+func (ch *Chain) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	var errs []error
+	for _, item := range ch.items {
+		if err := item.Guard.LogAppliedDelay(respDelay, clientID); err != nil {
+			errs = append(errs, fmt.Errorf("guard %s failed to log applied delay: %w", item.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// EvaluateRequest runs sub-guards in order. Release hooks
+// of all the evaluated sub-guards are combined into a single one. The evaluation
+// is short-circuited on the first error or on a response status
+// >= 400 or in case a sub-guard bypasses the rest of the chain
+// (see Bypasser). The ReqEvaluation.DecidedBy contains the name
+// of the guard which stopped the evaluation (or the last one
+// in case all the guards passed).
+func (ch *Chain) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) ReqEvaluation {
+	ans := ReqEvaluation{
+		ClientID:         common.InvalidUserID,
+		HumanID:          common.InvalidUserID,
+		ProposedResponse: http.StatusOK,
+	}
+	var releases []func()
+	for _, item := range ch.items {
+		eval := item.Guard.EvaluateRequest(req, fallbackCookie)
+		ans.DecidedBy = item.Name
+		if eval.Release != nil {
+			releases = append(releases, eval.Release)
+			ans.Release = combineReleases(releases)
+		}
+		if !ans.ClientID.IsValid() {
+			ans.ClientID = eval.ClientID
+		}
+		if !ans.HumanID.IsValid() {
+			ans.HumanID = eval.HumanID
+		}
+		if ans.SessionID == "" {
+			ans.SessionID = eval.SessionID
+		}
+		ans.RequiresFallbackCookie = ans.RequiresFallbackCookie || eval.RequiresFallbackCookie
+		for k, v := range eval.ResponseHeaders {
+			if ans.ResponseHeaders == nil {
+				ans.ResponseHeaders = http.Header{}
+			}
+			ans.ResponseHeaders[k] = append(ans.ResponseHeaders[k], v...)
+		}
+		if eval.Error != nil || eval.ProposedResponse >= http.StatusBadRequest {
+			ans.ProposedResponse = eval.ProposedResponse
+			ans.Error = eval.Error
+			ans.Reason = eval.Reason
+			ans.RetryAfter = eval.RetryAfter
+			return ans
+		}
+		if bypasses(item.Guard, req) {
+			return ans
+		}
+	}
+	return ans
+}
+
+func combineReleases(releases []func()) func() {
+	return func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+}
+
+// TestUserIsAnonymous returns true if any of the sub-guards
+// considers the user anonymous
+func (ch *Chain) TestUserIsAnonymous(userID common.UserID) bool {
+	for _, item := range ch.items {
+		if item.Guard.TestUserIsAnonymous(userID) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetermineTrueUserID returns the first valid user ID provided
+// by a sub-guard. Errors of sub-guards are returned only if no
+// valid ID is found.
+func (ch *Chain) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	var errs []error
+	for _, item := range ch.items {
+		userID, err := item.Guard.DetermineTrueUserID(req)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("guard %s failed to determine user ID: %w", item.Name, err))
+			continue
+		}
+		if userID.IsValid() {
+			return userID, nil
+		}
+	}
+	return common.InvalidUserID, errors.Join(errs...)
+}
+
+// NewChain creates a new guard chain. For an empty delayCombination,
+// DelayCombinationMax is used.
+func NewChain(delayCombination DelayCombination, items ...ChainItem) (*Chain, error) {
+	if delayCombination == "" {
+		delayCombination = DelayCombinationMax
+	}
+	if err := delayCombination.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to create guard chain: %w", err)
+	}
+	for i, item := range items {
+		if item.Guard == nil {
+			return nil, fmt.Errorf("failed to create guard chain: item %d (%s) has no guard", i, item.Name)
+		}
+	}
+	return &Chain{
+		items:            items,
+		delayCombination: delayCombination,
+	}, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/concurrency"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+	"github.com/czcorpus/apiguard-common/guard/ratelimit"
+	"github.com/czcorpus/apiguard-common/guard/session"
+)
+
+func newTestChain(t *testing.T, maxPerService, burst int) *guard.Chain {
+	t.Helper()
+	anonymousUsers := common.AnonymousUsers{0, 1}
+	concConf := &concurrency.Conf{MaxPerService: maxPerService, QueueTimeoutMs: 10}
+	if err := concConf.ValidateAndDefaults("concurrency"); err != nil {
+		t.Fatal(err)
+	}
+	rlConf := &ratelimit.Conf{
+		Anonymous:     ratelimit.BucketConf{RatePerSec: 0.001, Burst: burst},
+		Authenticated: ratelimit.BucketConf{RatePerSec: 0.001, Burst: burst},
+	}
+	if err := rlConf.ValidateAndDefaults("ratelimit"); err != nil {
+		t.Fatal(err)
+	}
+	sessConf := &session.Conf{Secret: "0123456789abcdef0123456789abcdef"}
+	if err := sessConf.ValidateAndDefaults("session"); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := guard.NewChain(
+		guard.DelayCombinationMax,
+		guard.ChainItem{Name: "session", Guard: session.NewGuard(sessConf)},
+		guard.ChainItem{Name: "concurrency", Guard: concurrency.NewGuard(concConf, anonymousUsers, guardtest.ResolveUserID)},
+		guard.ChainItem{Name: "ratelimit", Guard: ratelimit.NewGuard(rlConf, anonymousUsers, guardtest.ResolveUserID)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+func TestChainConformance(t *testing.T) {
+	chain := newTestChain(t, 100, 1000)
+	guardtest.Run(t, guardtest.Suite{
+		Guard:          chain,
+		AnonymousUsers: common.AnonymousUsers{0, 1},
+	})
+}
+
+func TestChainStopsOnRejection(t *testing.T) {
+	chain := newTestChain(t, 1, 1)
+	req := guardtest.NewRequest("/", "192.0.2.10")
+	req.Header.Set(guardtest.UserIDHeader, "key")
+	eval := chain.EvaluateRequest(req, nil)
+	if eval.ProposedResponse != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", eval.ProposedResponse)
+	}
+	if eval.SessionID == "" || eval.ResponseHeaders.Get("Set-Cookie") == "" {
+		t.Error("expected a new session from the session guard")
+	}
+	if eval.HumanID != guardtest.AuthenticatedUserID {
+		t.Errorf("expected user %s, got %s", guardtest.AuthenticatedUserID, eval.HumanID)
+	}
+	eval.ReleaseResources()
+
+	eval = chain.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.10"), nil)
+	if eval.ProposedResponse != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", eval.ProposedResponse)
+	}
+	eval.ReleaseResources()
+
+	// the rate limit is exceeded now
+	eval = chain.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.10"), nil)
+	if eval.ProposedResponse != http.StatusTooManyRequests || eval.DecidedBy != "ratelimit" {
+		t.Fatalf("expected 429 decided by ratelimit, got %d by %s", eval.ProposedResponse, eval.DecidedBy)
+	}
+	eval.ReleaseResources()
+	// slots reserved by guards evaluated before the rejecting one are released
+	eval = chain.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.11"), nil)
+	if eval.ProposedResponse != http.StatusOK {
+		t.Errorf("expected status 200 for another client, got %d (decided by %s)", eval.ProposedResponse, eval.DecidedBy)
+	}
+	eval.ReleaseResources()
+}
@@ -0,0 +1,401 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package challenge provides a guard requiring suspicious clients
+// to solve a hash-based proof-of-work challenge. Clients which submit
+// a valid solution obtain a short-lived signed clearance cookie.
+//
+// The flow is as follows:
+//  1. The guard rejects a suspicious request (403) and sends a signed
+//     challenge via the X-Apiguard-Challenge response header.
+//  2. The client finds a nonce such that SHA-256 of "<challenge>:<nonce>"
+//     starts with the required number of zero bits (see Solve).
+//  3. The client posts {"challenge": "...", "nonce": "..."} to an endpoint
+//     served by Guard.VerifyHandler and obtains a clearance cookie.
+//  4. Requests with a valid clearance cookie are accepted.
+package challenge
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+)
+
+const (
+	ChallengeHeader           = "X-Apiguard-Challenge"
+	ChallengeDifficultyHeader = "X-Apiguard-Challenge-Difficulty"
+
+	dfltCookieName       = "apiguard_clearance"
+	dfltDifficulty       = 18
+	maxDifficulty        = 32
+	dfltChallengeTTLSecs = 300
+	dfltClearanceTTLSecs = 3600
+	dfltIPv4PrefixBits   = 24
+	dfltIPv6PrefixBits   = 48
+	minSecretLength      = 32
+	seedBytes            = 16
+	macBytes             = 16
+	maxVerifyBodySize    = 4096
+)
+
+var (
+	ErrChallengeRequired  = errors.New("proof-of-work challenge required")
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrChallengeExpired   = errors.New("challenge expired")
+	ErrChallengeUsed      = errors.New("challenge already used")
+	ErrInvalidSolution    = errors.New("invalid challenge solution")
+	ErrMalformedClearance = errors.New("malformed clearance cookie")
+	ErrClearanceExpired   = errors.New("clearance expired")
+)
+
+// Detector decides whether a request comes from a bot-like client
+type Detector interface {
+	IsBotLike(req *http.Request) bool
+}
+
+// DetectorFunc allows using an ordinary function as a Detector
+type DetectorFunc func(req *http.Request) bool
+
+func (f DetectorFunc) IsBotLike(req *http.Request) bool {
+	return f(req)
+}
+
+// -----
+
+// Conf configures the challenge guard
+type Conf struct {
+
+	// Secret is used to sign challenges and clearance cookies.
+	// It must be at least 32 characters long.
+	Secret string `json:"secret"`
+
+	// Difficulty is a number of leading zero bits of a solution hash.
+	// Each additional bit doubles an expected client's work.
+	Difficulty int `json:"difficulty"`
+
+	ChallengeTTLSecs int `json:"challengeTtlSecs"`
+
+	ClearanceTTLSecs int `json:"clearanceTtlSecs"`
+
+	// IPv4PrefixBits and IPv6PrefixBits specify client IP network prefixes
+	// both challenges and clearances are bound to.
+	IPv4PrefixBits int `json:"ipv4PrefixBits"`
+	IPv6PrefixBits int `json:"ipv6PrefixBits"`
+
+	CookieName   string `json:"cookieName"`
+	CookiePath   string `json:"cookiePath"`
+	CookieSecure bool   `json:"cookieSecure"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if len(conf.Secret) < minSecretLength {
+		return fmt.Errorf("%s.secret must be at least %d characters long", context, minSecretLength)
+	}
+	if conf.Difficulty == 0 {
+		conf.Difficulty = dfltDifficulty
+	}
+	if conf.Difficulty < 1 || conf.Difficulty > maxDifficulty {
+		return fmt.Errorf("%s.difficulty must be between 1 and %d", context, maxDifficulty)
+	}
+	if conf.ChallengeTTLSecs == 0 {
+		conf.ChallengeTTLSecs = dfltChallengeTTLSecs
+	}
+	if conf.ClearanceTTLSecs == 0 {
+		conf.ClearanceTTLSecs = dfltClearanceTTLSecs
+	}
+	if conf.IPv4PrefixBits == 0 {
+		conf.IPv4PrefixBits = dfltIPv4PrefixBits
+	}
+	if conf.IPv4PrefixBits < 0 || conf.IPv4PrefixBits > 32 {
+		return fmt.Errorf("%s.ipv4PrefixBits must be between 0 and 32", context)
+	}
+	if conf.IPv6PrefixBits == 0 {
+		conf.IPv6PrefixBits = dfltIPv6PrefixBits
+	}
+	if conf.IPv6PrefixBits < 0 || conf.IPv6PrefixBits > 128 {
+		return fmt.Errorf("%s.ipv6PrefixBits must be between 0 and 128", context)
+	}
+	if conf.CookieName == "" {
+		conf.CookieName = dfltCookieName
+	}
+	if conf.CookiePath == "" {
+		conf.CookiePath = "/"
+	}
+	return nil
+}
+
+func (conf *Conf) challengeTTL() time.Duration {
+	return time.Duration(conf.ChallengeTTLSecs) * time.Second
+}
+
+func (conf *Conf) clearanceTTL() time.Duration {
+	return time.Duration(conf.ClearanceTTLSecs) * time.Second
+}
+
+// -----
+
+// Guard requires clients flagged bot-like by a Detector to solve
+// a proof-of-work challenge. Both challenges and clearance cookies
+// are HMAC-signed and bound to the client's IP network so no
+// server-side state is needed except for a list of already used
+// challenges (to prevent obtaining multiple clearances for a single
+// solution).
+type Guard struct {
+	conf       *Conf
+	detector   Detector
+	difficulty atomic.Int32
+	used       map[string]time.Time
+	lastSweep  time.Time
+	mu         sync.Mutex
+}
+
+func (g *Guard) sign(items ...string) string {
+	mac := hmac.New(sha256.New, []byte(g.conf.Secret))
+	mac.Write([]byte(strings.Join(items, ".")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:macBytes])
+}
+
+func (g *Guard) binding(req *http.Request) string {
+	return guard.ClientNetwork(req, g.conf.IPv4PrefixBits, g.conf.IPv6PrefixBits)
+}
+
+// Difficulty returns the current challenge difficulty
+func (g *Guard) Difficulty() int {
+	return int(g.difficulty.Load())
+}
+
+// SetDifficulty changes difficulty of newly issued challenges
+// (e.g. based on the current load). The value is clamped to [1, 32].
+func (g *Guard) SetDifficulty(difficulty int) {
+	g.difficulty.Store(int32(min(max(difficulty, 1), maxDifficulty)))
+}
+
+// NewChallenge creates a new signed challenge for the client.
+// The challenge has the form "<seed>.<expires>.<difficulty>.<mac>".
+func (g *Guard) NewChallenge(req *http.Request, now time.Time) (string, error) {
+	rnd := make([]byte, seedBytes)
+	if _, err := rand.Read(rnd); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	seed := base64.RawURLEncoding.EncodeToString(rnd)
+	expires := strconv.FormatInt(now.Add(g.conf.challengeTTL()).Unix(), 36)
+	difficulty := strconv.Itoa(g.Difficulty())
+	return strings.Join(
+		[]string{seed, expires, difficulty, g.sign(seed, expires, difficulty, g.binding(req))},
+		".",
+	), nil
+}
+
+// markUsed registers the challenge as used. It returns false
+// if the challenge has been already used.
+func (g *Guard) markUsed(challenge string, expires, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.lastSweep) > g.conf.challengeTTL() {
+		for k, exp := range g.used {
+			if now.After(exp) {
+				delete(g.used, k)
+			}
+		}
+		g.lastSweep = now
+	}
+	if _, ok := g.used[challenge]; ok {
+		return false
+	}
+	g.used[challenge] = expires
+	return true
+}
+
+// VerifySolution verifies the challenge and its solution. The challenge
+// can be used just once.
+func (g *Guard) VerifySolution(req *http.Request, challenge, nonce string, now time.Time) error {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return ErrMalformedChallenge
+	}
+	expected := g.sign(parts[0], parts[1], parts[2], g.binding(req))
+	if !hmac.Equal([]byte(expected), []byte(parts[3])) {
+		return ErrInvalidSignature
+	}
+	expiresUnix, err := strconv.ParseInt(parts[1], 36, 64)
+	if err != nil {
+		return ErrMalformedChallenge
+	}
+	expires := time.Unix(expiresUnix, 0)
+	if now.After(expires) {
+		return ErrChallengeExpired
+	}
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return ErrMalformedChallenge
+	}
+	if !IsSolution(challenge, nonce, difficulty) {
+		return ErrInvalidSolution
+	}
+	if !g.markUsed(challenge, expires, now) {
+		return ErrChallengeUsed
+	}
+	return nil
+}
+
+// NewClearance creates a signed clearance cookie value
+// of the form "<expires>.<mac>".
+func (g *Guard) NewClearance(req *http.Request, now time.Time) string {
+	expires := strconv.FormatInt(now.Add(g.conf.clearanceTTL()).Unix(), 36)
+	return expires + "." + g.sign("clearance", expires, g.binding(req))
+}
+
+// ValidateClearance validates a clearance cookie value
+func (g *Guard) ValidateClearance(req *http.Request, value string, now time.Time) error {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return ErrMalformedClearance
+	}
+	expected := g.sign("clearance", parts[0], g.binding(req))
+	if !hmac.Equal([]byte(expected), []byte(parts[1])) {
+		return ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(parts[0], 36, 64)
+	if err != nil {
+		return ErrMalformedClearance
+	}
+	if now.After(time.Unix(expires, 0)) {
+		return ErrClearanceExpired
+	}
+	return nil
+}
+
+func (g *Guard) hasClearance(req *http.Request, now time.Time) bool {
+	cookie, err := req.Cookie(g.conf.CookieName)
+	if err != nil {
+		return false
+	}
+	return g.ValidateClearance(req, cookie.Value, now) == nil
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	ans := guard.ReqEvaluation{
+		ClientID:         common.InvalidUserID,
+		HumanID:          common.InvalidUserID,
+		ProposedResponse: http.StatusOK,
+	}
+	now := time.Now()
+	if g.hasClearance(req, now) || !g.detector.IsBotLike(req) {
+		return ans
+	}
+	challenge, err := g.NewChallenge(req, now)
+	if err != nil {
+		ans.ProposedResponse = http.StatusInternalServerError
+		ans.Reason = guard.ReasonInternalError
+		ans.Error = err
+		return ans
+	}
+	ans.ProposedResponse = http.StatusForbidden
+	ans.Reason = guard.ReasonChallengeRequired
+	ans.Error = ErrChallengeRequired
+	difficulty, _ := ChallengeDifficulty(challenge)
+	ans.ResponseHeaders = http.Header{
+		ChallengeHeader:           []string{challenge},
+		ChallengeDifficultyHeader: []string{strconv.Itoa(difficulty)},
+	}
+	return ans
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	return false
+}
+
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	return common.InvalidUserID, nil
+}
+
+type solutionArgs struct {
+	Challenge string `json:"challenge"`
+	Nonce     string `json:"nonce"`
+}
+
+// VerifyHandler returns an HTTP handler accepting challenge solutions
+// (a JSON object with "challenge" and "nonce" properties sent via POST).
+// For a valid solution, the handler responds with a clearance cookie.
+func (g *Guard) VerifyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			uniresp.WriteJSONErrorResponse(
+				w, uniresp.NewActionError("method not allowed"), http.StatusMethodNotAllowed)
+			return
+		}
+		var args solutionArgs
+		if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxVerifyBodySize)).Decode(&args); err != nil {
+			uniresp.WriteJSONErrorResponse(
+				w, uniresp.NewActionError("invalid request body: %s", err), http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		if err := g.VerifySolution(req, args.Challenge, args.Nonce, now); err != nil {
+			uniresp.WriteJSONErrorResponse(w, uniresp.NewActionErrorFrom(err), http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     g.conf.CookieName,
+			Value:    g.NewClearance(req, now),
+			Path:     g.conf.CookiePath,
+			MaxAge:   g.conf.ClearanceTTLSecs,
+			Secure:   g.conf.CookieSecure,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		uniresp.WriteJSONResponse(w, map[string]any{"ok": true})
+	}
+}
+
+// NewGuard creates a new challenge guard. The detector decides which
+// clients have to solve a challenge.
+func NewGuard(conf *Conf, detector Detector) *Guard {
+	ans := &Guard{
+		conf:      conf,
+		detector:  detector,
+		used:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+	ans.SetDifficulty(conf.Difficulty)
+	return ans
+}
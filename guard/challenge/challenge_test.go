@@ -0,0 +1,142 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+)
+
+func newTestGuard(t *testing.T) *Guard {
+	t.Helper()
+	conf := &Conf{Secret: "0123456789abcdef0123456789abcdef", Difficulty: 4}
+	if err := conf.ValidateAndDefaults("challenge"); err != nil {
+		t.Fatal(err)
+	}
+	detector := DetectorFunc(func(req *http.Request) bool {
+		return strings.HasPrefix(req.UserAgent(), "python-requests")
+	})
+	return NewGuard(conf, detector)
+}
+
+func botRequest(clientIP string) *http.Request {
+	req := guardtest.NewRequest("/api/query", clientIP)
+	req.Header.Set("User-Agent", "python-requests/2.31.0")
+	return req
+}
+
+func postSolution(g *Guard, clientIP, challenge, nonce string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(solutionArgs{Challenge: challenge, Nonce: nonce})
+	req := httptest.NewRequest(http.MethodPost, "/challenge/verify", strings.NewReader(string(body)))
+	req.RemoteAddr = net.JoinHostPort(clientIP, "54321")
+	w := httptest.NewRecorder()
+	g.VerifyHandler()(w, req)
+	return w
+}
+
+func TestConformance(t *testing.T) {
+	guardtest.Run(t, guardtest.Suite{Guard: newTestGuard(t)})
+}
+
+func TestChallengeFlow(t *testing.T) {
+	g := newTestGuard(t)
+
+	eval := g.EvaluateRequest(guardtest.NewRequest("/api/query", "192.0.2.10"), nil)
+	if eval.ProposedResponse != http.StatusOK {
+		t.Fatalf("expected 200 for a regular client, got %d", eval.ProposedResponse)
+	}
+
+	eval = g.EvaluateRequest(botRequest("192.0.2.10"), nil)
+	if eval.ProposedResponse != http.StatusForbidden || eval.Reason != guard.ReasonChallengeRequired {
+		t.Fatalf("expected 403 challenge required, got %d (%s)", eval.ProposedResponse, eval.Reason)
+	}
+	challenge := eval.ResponseHeaders.Get(ChallengeHeader)
+	if challenge == "" {
+		t.Fatal("missing challenge header")
+	}
+	if d := eval.ResponseHeaders.Get(ChallengeDifficultyHeader); d != "4" {
+		t.Errorf("expected difficulty 4, got %s", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	nonce, err := Solve(ctx, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a solution from a different network is not accepted
+	if w := postSolution(g, "198.51.100.10", challenge, nonce); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a different network, got %d", w.Code)
+	}
+
+	w := postSolution(g, "192.0.2.10", challenge, nonce)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a valid solution, got %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != g.conf.CookieName {
+		t.Fatalf("expected a clearance cookie, got %v", cookies)
+	}
+
+	// a single solution cannot be used twice
+	if w := postSolution(g, "192.0.2.10", challenge, nonce); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a reused solution, got %d", w.Code)
+	}
+
+	// the clearance is accepted within the bound network only
+	req := botRequest("192.0.2.99")
+	req.AddCookie(cookies[0])
+	if eval := g.EvaluateRequest(req, nil); eval.ProposedResponse != http.StatusOK {
+		t.Errorf("expected 200 with a clearance cookie, got %d", eval.ProposedResponse)
+	}
+	req = botRequest("198.51.100.10")
+	req.AddCookie(cookies[0])
+	if eval := g.EvaluateRequest(req, nil); eval.ProposedResponse != http.StatusForbidden {
+		t.Errorf("expected 403 with a clearance from a different network, got %d", eval.ProposedResponse)
+	}
+}
+
+func TestInvalidSolution(t *testing.T) {
+	g := newTestGuard(t)
+	g.SetDifficulty(maxDifficulty)
+	challenge, err := g.NewChallenge(botRequest("192.0.2.10"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.VerifySolution(botRequest("192.0.2.10"), challenge, "0", time.Now()); !errors.Is(err, ErrInvalidSolution) {
+		t.Errorf("expected ErrInvalidSolution, got %v", err)
+	}
+	if err := g.VerifySolution(botRequest("192.0.2.10"), challenge, "0", time.Now().Add(time.Hour)); !errors.Is(err, ErrChallengeExpired) {
+		t.Errorf("expected ErrChallengeExpired, got %v", err)
+	}
+	tampered := strings.Replace(challenge, ".32.", ".1.", 1)
+	if err := g.VerifySolution(botRequest("192.0.2.10"), tampered, "0", time.Now()); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature for a tampered difficulty, got %v", err)
+	}
+}
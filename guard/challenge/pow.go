@@ -0,0 +1,89 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package challenge
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMalformedChallenge = errors.New("malformed challenge")
+)
+
+// leadingZeroBits returns number of leading zero bits of the data
+func leadingZeroBits(data []byte) int {
+	var ans int
+	for _, b := range data {
+		if b != 0 {
+			return ans + bits.LeadingZeros8(b)
+		}
+		ans += 8
+	}
+	return ans
+}
+
+// solutionHash returns a hash a client must find a nonce for
+func solutionHash(challenge, nonce string) []byte {
+	h := sha256.Sum256([]byte(challenge + ":" + nonce))
+	return h[:]
+}
+
+// IsSolution tests whether the nonce solves the challenge, i.e. whether
+// SHA-256 of "<challenge>:<nonce>" starts with at least `difficulty`
+// zero bits.
+func IsSolution(challenge, nonce string, difficulty int) bool {
+	return leadingZeroBits(solutionHash(challenge, nonce)) >= difficulty
+}
+
+// ChallengeDifficulty extracts difficulty encoded in a challenge
+// (please note that the value is not authenticated here).
+func ChallengeDifficulty(challenge string) (int, error) {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return 0, ErrMalformedChallenge
+	}
+	ans, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, ErrMalformedChallenge
+	}
+	return ans, nil
+}
+
+// Solve finds a nonce solving the challenge by brute force. It is
+// a reference implementation of the client side (which is typically
+// written in JavaScript).
+func Solve(ctx context.Context, challenge string) (string, error) {
+	difficulty, err := ChallengeDifficulty(challenge)
+	if err != nil {
+		return "", err
+	}
+	for i := uint64(0); ; i++ {
+		if i%10000 == 0 && ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		nonce := strconv.FormatUint(i, 36)
+		if IsSolution(challenge, nonce, difficulty) {
+			return nonce, nil
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/czcorpus/apiguard-common/common"
+)
+
+var trustedProxies atomic.Pointer[[]netip.Prefix]
+
+// SetTrustedProxies configures addresses (or CIDR networks) of reverse
+// proxies allowed to provide a client address via forwarding headers
+// (see ClientAddr). Without trusted proxies, forwarding headers are ignored.
+// The function is expected to be called once during application startup.
+func SetTrustedProxies(proxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, p := range proxies {
+		prefix, err := common.ParseIPPrefix(p)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %s: %w", p, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	trustedProxies.Store(&prefixes)
+	return nil
+}
+
+// IsTrustedProxy tests whether the addr belongs to a proxy
+// configured via SetTrustedProxies
+func IsTrustedProxy(addr netip.Addr) bool {
+	prefixes := trustedProxies.Load()
+	if prefixes == nil || !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range *prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerAddr returns an address of the immediate peer (see common.PeerAddr)
+func PeerAddr(req *http.Request) netip.Addr {
+	return common.PeerAddr(req)
+}
+
+// forwardedAddr walks the X-Forwarded-For header from the right
+// (i.e. from the hop closest to us), skipping trusted proxies, and returns
+// the first untrusted address. In case all the addresses are trusted,
+// the leftmost one is returned.
+func forwardedAddr(req *http.Request) netip.Addr {
+	var hops []string
+	for _, v := range req.Header.Values("x-forwarded-for") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	var ans netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// we cannot trust anything beyond a malformed hop
+			return ans
+		}
+		ans = addr.Unmap()
+		if !IsTrustedProxy(ans) {
+			return ans
+		}
+	}
+	return ans
+}
+
+// ClientAddr determines a client IP address. The address is taken from
+// req.RemoteAddr unless the immediate peer is a trusted proxy
+// (see SetTrustedProxies). In such case, the X-Forwarded-For header
+// is walked from the right and the first address not belonging to a trusted
+// proxy is used. Single-value headers X-Real-IP and X-Client-IP are used
+// only if there is no valid X-Forwarded-For. In case no valid address
+// is found, an invalid (zero) netip.Addr is returned.
+func ClientAddr(req *http.Request) netip.Addr {
+	peer := PeerAddr(req)
+	if !IsTrustedProxy(peer) {
+		return peer
+	}
+	if addr := forwardedAddr(req); addr.IsValid() {
+		return addr
+	}
+	for _, header := range []string{"x-real-ip", "x-client-ip"} {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(req.Header.Get(header))); err == nil {
+			return addr.Unmap()
+		}
+	}
+	return peer
+}
+
+// HasUntrustedForwarding tests whether the request contains forwarding
+// headers which have been ignored by ClientAddr as the immediate peer
+// is not a trusted proxy. Such requests should not be granted any privileges
+// based on their address.
+func HasUntrustedForwarding(req *http.Request) bool {
+	if IsTrustedProxy(PeerAddr(req)) {
+		return false
+	}
+	for _, header := range []string{"x-forwarded-for", "x-real-ip", "x-client-ip"} {
+		if req.Header.Get(header) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIPString returns a string representation of ClientAddr
+// (or an empty string if no address is found).
+func ClientIPString(req *http.Request) string {
+	addr := ClientAddr(req)
+	if !addr.IsValid() {
+		return ""
+	}
+	return addr.String()
+}
+
+// ClientNetwork returns a network prefix of the client's address
+// (e.g. "192.168.1.0/24"). In case the address cannot be determined,
+// an empty string is returned.
+func ClientNetwork(req *http.Request, ipv4PrefixBits, ipv6PrefixBits int) string {
+	addr := ClientAddr(req)
+	bits := ipv6PrefixBits
+	if addr.Is4() {
+		bits = ipv4PrefixBits
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
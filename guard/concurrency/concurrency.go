@@ -0,0 +1,278 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package concurrency provides a guard limiting numbers of simultaneous
+// in-flight requests per client and per service.
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/userclass"
+)
+
+const (
+	dfltQueueTimeoutMs = 5000
+)
+
+var (
+	// ErrClientQueueFull means the client has too many requests in-flight
+	// and also the waiting queue is full
+	ErrClientQueueFull = errors.New("too many concurrent requests from the client")
+
+	// ErrServiceQueueFull means the service has too many requests in-flight
+	// and also the waiting queue is full
+	ErrServiceQueueFull = errors.New("too many concurrent requests to the service")
+
+	// ErrQueueTimeout means the request waited in the queue for too long
+	ErrQueueTimeout = errors.New("timeout waiting for a free request slot")
+)
+
+// Conf configures concurrency limits. Zero limits mean "no limit".
+type Conf struct {
+	MaxPerClient   int `json:"maxPerClient"`
+	MaxPerService  int `json:"maxPerService"`
+	QueueSize      int `json:"queueSize"`
+	QueueTimeoutMs int `json:"queueTimeoutMs"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if conf.MaxPerClient < 0 || conf.MaxPerService < 0 || conf.QueueSize < 0 {
+		return fmt.Errorf("%s: limits cannot be negative", context)
+	}
+	if conf.QueueTimeoutMs == 0 {
+		conf.QueueTimeoutMs = dfltQueueTimeoutMs
+	}
+	return nil
+}
+
+// -----
+
+// Limiter limits numbers of in-flight requests. Requests over
+// the limit wait in a bounded queue. Limiter is safe for concurrent use.
+type Limiter struct {
+	conf       *Conf
+	perClient  map[string]int
+	numService int
+	numWaiting int
+	changed    chan struct{}
+	mu         sync.Mutex
+}
+
+// canAcquire must be called with the lock held
+func (lim *Limiter) canAcquire(key string, maxPerClient int) error {
+	if maxPerClient > 0 && lim.perClient[key] >= maxPerClient {
+		return ErrClientQueueFull
+	}
+	if lim.conf.MaxPerService > 0 && lim.numService >= lim.conf.MaxPerService {
+		return ErrServiceQueueFull
+	}
+	return nil
+}
+
+func (lim *Limiter) release(key string) {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	lim.numService--
+	lim.perClient[key]--
+	if lim.perClient[key] <= 0 {
+		delete(lim.perClient, key)
+	}
+	// wake up all the waiting requests
+	close(lim.changed)
+	lim.changed = make(chan struct{})
+}
+
+// Acquire reserves a request slot for the client. In case no slot
+// is available, the request waits in a queue. The returned function
+// must be called to release the slot once the request is handled
+// (it is safe to call it multiple times).
+func (lim *Limiter) Acquire(ctx context.Context, clientID common.ClientID) (func(), error) {
+	return lim.AcquireWithLimit(ctx, clientID, lim.conf.MaxPerClient)
+}
+
+// AcquireWithLimit works like Acquire but with a custom per-client limit
+// (zero means "no limit"). The per-service limit still applies.
+func (lim *Limiter) AcquireWithLimit(
+	ctx context.Context,
+	clientID common.ClientID,
+	maxPerClient int,
+) (func(), error) {
+	key := clientID.GetKey()
+	timeout := time.NewTimer(time.Duration(lim.conf.QueueTimeoutMs) * time.Millisecond)
+	defer timeout.Stop()
+	lim.mu.Lock()
+	for {
+		limitErr := lim.canAcquire(key, maxPerClient)
+		if limitErr == nil {
+			lim.numService++
+			lim.perClient[key]++
+			lim.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { lim.release(key) }) }, nil
+		}
+		if lim.numWaiting >= lim.conf.QueueSize {
+			lim.mu.Unlock()
+			return nil, limitErr
+		}
+		lim.numWaiting++
+		changed := lim.changed
+		lim.mu.Unlock()
+		var waitErr error
+		select {
+		case <-changed:
+		case <-timeout.C:
+			waitErr = ErrQueueTimeout
+		case <-ctx.Done():
+			waitErr = ctx.Err()
+		}
+		lim.mu.Lock()
+		lim.numWaiting--
+		if waitErr != nil {
+			lim.mu.Unlock()
+			return nil, waitErr
+		}
+	}
+}
+
+// InFlight returns number of currently handled requests
+func (lim *Limiter) InFlight() int {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	return lim.numService
+}
+
+func NewLimiter(conf *Conf) *Limiter {
+	return &Limiter{
+		conf:      conf,
+		perClient: make(map[string]int),
+		changed:   make(chan struct{}),
+	}
+}
+
+// -----
+
+// Guard is a ServiceGuard wrapper around Limiter. A successful
+// evaluation holds a request slot until ReqEvaluation.Release is called.
+type Guard struct {
+	limiter        *Limiter
+	anonymousUsers common.AnonymousUsers
+	resolveUserID  guard.UserIDResolver
+	classifier     *userclass.Classifier
+}
+
+// maxPerClient returns a per-client limit for the request, taking
+// a possible user class into account
+func (g *Guard) maxPerClient(req *http.Request, userID common.UserID) int {
+	if g.classifier != nil {
+		if c := g.classifier.ForRequest(req, userID); c != nil && c.MaxConcurrent > 0 {
+			return c.MaxConcurrent
+		}
+	}
+	return g.limiter.conf.MaxPerClient
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	ans := guard.ReqEvaluation{
+		ClientID:         common.InvalidUserID,
+		HumanID:          common.InvalidUserID,
+		ProposedResponse: http.StatusOK,
+	}
+	userID, err := g.DetermineTrueUserID(req)
+	if err != nil {
+		ans.ProposedResponse = http.StatusInternalServerError
+		ans.Reason = guard.ReasonInternalError
+		ans.Error = err
+		return ans
+	}
+	ans.ClientID = userID
+	ans.HumanID = userID
+	release, err := g.limiter.AcquireWithLimit(
+		req.Context(),
+		common.ClientID{IP: guard.ClientIPString(req), ID: userID},
+		g.maxPerClient(req, userID),
+	)
+	switch {
+	case errors.Is(err, ErrClientQueueFull):
+		ans.ProposedResponse = http.StatusTooManyRequests
+		ans.Reason = guard.ReasonConcurrencyLimited
+		ans.Error = err
+	case err != nil:
+		ans.ProposedResponse = http.StatusServiceUnavailable
+		ans.Reason = guard.ReasonConcurrencyLimited
+		ans.Error = err
+	default:
+		ans.Release = release
+	}
+	return ans
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	return g.anonymousUsers.IsAnonymous(userID)
+}
+
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	if g.resolveUserID == nil {
+		return common.InvalidUserID, nil
+	}
+	return g.resolveUserID(req)
+}
+
+// GuardWithClassifier makes the guard use per-client limits of user classes.
+// Users whose class has no limit use the guard's own configuration.
+func GuardWithClassifier(classifier *userclass.Classifier) func(*Guard) {
+	return func(g *Guard) {
+		g.classifier = classifier
+	}
+}
+
+// NewGuard creates a new concurrency limiting guard. The resolveUserID
+// may be nil in which case clients are distinguished just by their IP.
+func NewGuard(
+	conf *Conf,
+	anonymousUsers common.AnonymousUsers,
+	resolveUserID guard.UserIDResolver,
+	opts ...func(*Guard),
+) *Guard {
+	ans := &Guard{
+		limiter:        NewLimiter(conf),
+		anonymousUsers: anonymousUsers,
+		resolveUserID:  resolveUserID,
+	}
+	for _, opt := range opts {
+		opt(ans)
+	}
+	return ans
+}
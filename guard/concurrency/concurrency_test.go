@@ -0,0 +1,98 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package concurrency
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+)
+
+func newTestGuard(t *testing.T, conf *Conf) *Guard {
+	t.Helper()
+	if err := conf.ValidateAndDefaults("concurrency"); err != nil {
+		t.Fatal(err)
+	}
+	return NewGuard(conf, common.AnonymousUsers{0, 1}, guardtest.ResolveUserID)
+}
+
+func TestConformance(t *testing.T) {
+	conf := &Conf{
+		MaxPerClient:   2,
+		MaxPerService:  4,
+		QueueSize:      2,
+		QueueTimeoutMs: 10,
+	}
+	guardtest.Run(t, guardtest.Suite{
+		Guard:          newTestGuard(t, conf),
+		AnonymousUsers: common.AnonymousUsers{0, 1},
+	})
+}
+
+func TestServiceQueueOverflow(t *testing.T) {
+	g := newTestGuard(t, &Conf{MaxPerService: 2, QueueSize: 0})
+	first := g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.10"), nil)
+	second := g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.11"), nil)
+	if first.ProposedResponse != http.StatusOK || second.ProposedResponse != http.StatusOK {
+		t.Fatalf("expected requests within the limit to pass, got %d and %d",
+			first.ProposedResponse, second.ProposedResponse)
+	}
+	eval := g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.12"), nil)
+	if eval.ProposedResponse != http.StatusServiceUnavailable || eval.Reason != guard.ReasonConcurrencyLimited {
+		t.Fatalf("expected 503 concurrency limited, got %d (%s)", eval.ProposedResponse, eval.Reason)
+	}
+	if !errors.Is(eval.Error, ErrServiceQueueFull) {
+		t.Errorf("expected ErrServiceQueueFull, got %v", eval.Error)
+	}
+	first.ReleaseResources()
+	eval = g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.12"), nil)
+	if eval.ProposedResponse != http.StatusOK {
+		t.Errorf("expected 200 after a slot was released, got %d", eval.ProposedResponse)
+	}
+	eval.ReleaseResources()
+	second.ReleaseResources()
+}
+
+func TestQueueTimeout(t *testing.T) {
+	g := newTestGuard(t, &Conf{MaxPerService: 1, QueueSize: 1, QueueTimeoutMs: 20})
+	first := g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.10"), nil)
+	defer first.ReleaseResources()
+	t0 := time.Now()
+	eval := g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.11"), nil)
+	if eval.ProposedResponse != http.StatusServiceUnavailable || !errors.Is(eval.Error, ErrQueueTimeout) {
+		t.Fatalf("expected 503 with ErrQueueTimeout, got %d (%v)", eval.ProposedResponse, eval.Error)
+	}
+	if elapsed := time.Since(t0); elapsed < 20*time.Millisecond {
+		t.Errorf("expected the request to wait in the queue, waited %v", elapsed)
+	}
+}
+
+func TestClientLimit(t *testing.T) {
+	g := newTestGuard(t, &Conf{MaxPerClient: 1, MaxPerService: 10})
+	first := g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.10"), nil)
+	defer first.ReleaseResources()
+	eval := g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.10"), nil)
+	if eval.ProposedResponse != http.StatusTooManyRequests || !errors.Is(eval.Error, ErrClientQueueFull) {
+		t.Errorf("expected 429 with ErrClientQueueFull, got %d (%v)", eval.ProposedResponse, eval.Error)
+	}
+}
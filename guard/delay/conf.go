@@ -0,0 +1,146 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delay
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	CurveLinear      CurveType = "linear"
+	CurveExponential CurveType = "exponential"
+	CurveStep        CurveType = "step"
+
+	dfltHalfLifeSecs = 60
+)
+
+// CurveType specifies how a client activity score is mapped
+// to a delay
+type CurveType string
+
+// Step defines a delay applied for scores >= MinScore
+type Step struct {
+	MinScore float64 `json:"minScore"`
+	DelayMs  int     `json:"delayMs"`
+}
+
+// Conf configures the progressive delay calculation.
+//
+// Each client has a score representing its recent activity. Each request
+// adds 1 to the score and the score decays exponentially with the half-life
+// HalfLifeSecs. I.e. a client sending requests at a constant rate r (req/s)
+// converges to the score r * HalfLifeSecs / ln(2).
+type Conf struct {
+	HalfLifeSecs float64 `json:"halfLifeSecs"`
+
+	// ThresholdScore is a score up to which no delay is applied
+	ThresholdScore float64 `json:"thresholdScore"`
+
+	Curve CurveType `json:"curve"`
+
+	// LinearMsPerPoint is used with the linear curve as:
+	// delay = LinearMsPerPoint * (score - ThresholdScore)
+	LinearMsPerPoint float64 `json:"linearMsPerPoint"`
+
+	// ExpBaseMs and ExpFactor are used with the exponential curve as:
+	// delay = ExpBaseMs * (ExpFactor^(score - ThresholdScore) - 1)
+	ExpBaseMs float64 `json:"expBaseMs"`
+	ExpFactor float64 `json:"expFactor"`
+
+	// Steps are used with the step curve. The step with the highest
+	// MinScore lower or equal to the score is applied.
+	// ThresholdScore is not used with the step curve.
+	Steps []Step `json:"steps"`
+
+	// MaxDelayMs caps the calculated delay
+	MaxDelayMs int `json:"maxDelayMs"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if conf.HalfLifeSecs == 0 {
+		conf.HalfLifeSecs = dfltHalfLifeSecs
+	}
+	if conf.HalfLifeSecs < 0 {
+		return fmt.Errorf("%s.halfLifeSecs must be a positive number", context)
+	}
+	if conf.MaxDelayMs <= 0 {
+		return fmt.Errorf("%s.maxDelayMs must be a positive number", context)
+	}
+	switch conf.Curve {
+	case CurveLinear:
+		if conf.LinearMsPerPoint <= 0 {
+			return fmt.Errorf("%s.linearMsPerPoint must be a positive number", context)
+		}
+	case CurveExponential:
+		if conf.ExpBaseMs <= 0 {
+			return fmt.Errorf("%s.expBaseMs must be a positive number", context)
+		}
+		if conf.ExpFactor <= 1 {
+			return fmt.Errorf("%s.expFactor must be greater than 1", context)
+		}
+	case CurveStep:
+		if len(conf.Steps) == 0 {
+			return fmt.Errorf("%s.steps cannot be empty for the step curve", context)
+		}
+		slices.SortFunc(conf.Steps, func(a, b Step) int {
+			if a.MinScore < b.MinScore {
+				return -1
+			}
+			if a.MinScore > b.MinScore {
+				return 1
+			}
+			return 0
+		})
+	default:
+		return fmt.Errorf("%s.curve has an invalid value: %s", context, conf.Curve)
+	}
+	return nil
+}
+
+// HalfLife returns the score half-life as time.Duration
+func (conf *Conf) HalfLife() time.Duration {
+	return time.Duration(conf.HalfLifeSecs * float64(time.Second))
+}
+
+// DelayFor maps a score to a delay based on the configured curve
+func (conf *Conf) DelayFor(score float64) time.Duration {
+	var ms float64
+	switch conf.Curve {
+	case CurveLinear:
+		ms = conf.LinearMsPerPoint * (score - conf.ThresholdScore)
+	case CurveExponential:
+		ms = conf.ExpBaseMs * (math.Pow(conf.ExpFactor, score-conf.ThresholdScore) - 1)
+	case CurveStep:
+		for _, step := range conf.Steps {
+			if score >= step.MinScore {
+				ms = float64(step.DelayMs)
+			}
+		}
+	}
+	if conf.Curve != CurveStep && score <= conf.ThresholdScore {
+		return 0
+	}
+	ms = min(max(ms, 0), float64(conf.MaxDelayMs))
+	return time.Duration(ms * float64(time.Millisecond))
+}
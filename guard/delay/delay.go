@@ -0,0 +1,199 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package delay provides a reusable progressive delay calculation
+// for ServiceGuard implementations.
+package delay
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard/userclass"
+	"github.com/czcorpus/apiguard-common/telemetry"
+)
+
+const (
+	// minRelevantScore is a score below which a client record
+	// is considered idle and can be evicted
+	minRelevantScore = 0.01
+	sweepInterval    = time.Minute
+)
+
+// Store keeps client activity scores.
+type Store interface {
+
+	// RegisterRequest adds a request to the client's decayed score
+	// and returns the updated value.
+	RegisterRequest(clientID common.ClientID, now time.Time) (float64, error)
+
+	// LogAppliedDelay stores information about applied delay
+	// (the signature matches telemetry.Storage.LogAppliedDelay).
+	LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error
+}
+
+// DelayLogger is anything able to store applied delays
+// (e.g. telemetry.Storage)
+type DelayLogger interface {
+	LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error
+}
+
+var _ DelayLogger = (telemetry.Storage)(nil)
+
+// -----
+
+type scoreRecord struct {
+	score   float64
+	updated time.Time
+}
+
+func (sr scoreRecord) decayed(now time.Time, halfLife time.Duration) float64 {
+	elapsed := now.Sub(sr.updated)
+	if elapsed <= 0 {
+		return sr.score
+	}
+	return sr.score * math.Exp2(-elapsed.Seconds()/halfLife.Seconds())
+}
+
+// MemoryStore is an in-memory implementation of Store. Idle client
+// records are periodically evicted. Applied delays can be optionally
+// passed to a DelayLogger (typically telemetry.Storage).
+type MemoryStore struct {
+	halfLife    time.Duration
+	scores      map[string]scoreRecord
+	lastSweep   time.Time
+	delayLogger DelayLogger
+	mu          sync.Mutex
+}
+
+func (ms *MemoryStore) sweep(now time.Time) {
+	for k, v := range ms.scores {
+		if v.decayed(now, ms.halfLife) < minRelevantScore {
+			delete(ms.scores, k)
+		}
+	}
+	ms.lastSweep = now
+}
+
+func (ms *MemoryStore) RegisterRequest(clientID common.ClientID, now time.Time) (float64, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if now.Sub(ms.lastSweep) > sweepInterval {
+		ms.sweep(now)
+	}
+	key := clientID.GetKey()
+	rec := ms.scores[key]
+	rec.score = rec.decayed(now, ms.halfLife) + 1
+	rec.updated = now
+	ms.scores[key] = rec
+	return rec.score, nil
+}
+
+func (ms *MemoryStore) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	if ms.delayLogger == nil {
+		return nil
+	}
+	return ms.delayLogger.LogAppliedDelay(respDelay, clientID)
+}
+
+// NumClients returns number of tracked clients
+func (ms *MemoryStore) NumClients() int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return len(ms.scores)
+}
+
+// NewMemoryStore creates a new in-memory score store. The delayLogger
+// is optional.
+func NewMemoryStore(halfLife time.Duration, delayLogger DelayLogger) *MemoryStore {
+	return &MemoryStore{
+		halfLife:    halfLife,
+		scores:      make(map[string]scoreRecord),
+		lastSweep:   time.Now(),
+		delayLogger: delayLogger,
+	}
+}
+
+// NewTelemetryStore creates an in-memory score store which stores
+// applied delays to the telemetry database (see telemetry.Storage.AnalyzeDelayLog
+// for their analysis).
+func NewTelemetryStore(halfLife time.Duration, telemetryDB telemetry.Storage) *MemoryStore {
+	return NewMemoryStore(halfLife, telemetryDB)
+}
+
+// -----
+
+// Calculator calculates progressive delays based on recent client
+// activity. Its methods match the respective ServiceGuard methods so
+// guard implementations can just delegate to it.
+type Calculator struct {
+	conf       *Conf
+	store      Store
+	classifier *userclass.Classifier
+}
+
+// CalcDelayAt registers a request of the client made at the time `now`
+// and returns a delay which should be applied.
+func (calc *Calculator) CalcDelayAt(clientID common.ClientID, now time.Time) (time.Duration, error) {
+	score, err := calc.store.RegisterRequest(clientID, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to calculate delay: %w", err)
+	}
+	ans := calc.conf.DelayFor(score)
+	if calc.classifier != nil {
+		if c := calc.classifier.ForUser(clientID.ID); c != nil && c.MaxDelayMs > 0 {
+			ans = min(ans, time.Duration(c.MaxDelayMs)*time.Millisecond)
+		}
+	}
+	return ans, nil
+}
+
+func (calc *Calculator) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return calc.CalcDelayAt(clientID, time.Now())
+}
+
+func (calc *Calculator) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return calc.store.LogAppliedDelay(respDelay, clientID)
+}
+
+// CalculatorWithClassifier makes the calculator cap delays by
+// the MaxDelayMs of user classes.
+func CalculatorWithClassifier(classifier *userclass.Classifier) func(*Calculator) {
+	return func(calc *Calculator) {
+		calc.classifier = classifier
+	}
+}
+
+// NewCalculator creates a new delay calculator. In case store is nil,
+// a MemoryStore without any delay logging is used.
+func NewCalculator(conf *Conf, store Store, opts ...func(*Calculator)) *Calculator {
+	if store == nil {
+		store = NewMemoryStore(conf.HalfLife(), nil)
+	}
+	ans := &Calculator{
+		conf:  conf,
+		store: store,
+	}
+	for _, opt := range opts {
+		opt(ans)
+	}
+	return ans
+}
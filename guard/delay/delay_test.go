@@ -0,0 +1,308 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delay
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/telemetry"
+)
+
+// simulateTraffic sends requests at a constant rate (req/s) for
+// the specified duration and returns the delay calculated for the last one
+func simulateTraffic(
+	t *testing.T,
+	calc *Calculator,
+	clientID common.ClientID,
+	start time.Time,
+	rate float64,
+	duration time.Duration,
+) (time.Duration, time.Time) {
+	t.Helper()
+	interval := time.Duration(float64(time.Second) / rate)
+	var delay time.Duration
+	now := start
+	for ; now.Sub(start) < duration; now = now.Add(interval) {
+		var err error
+		delay, err = calc.CalcDelayAt(clientID, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	return delay, now
+}
+
+func mustConf(t *testing.T, conf Conf) *Conf {
+	t.Helper()
+	if err := conf.ValidateAndDefaults("delay"); err != nil {
+		t.Fatalf("invalid conf: %s", err)
+	}
+	return &conf
+}
+
+// steadyScore is a score a client converges to when sending requests
+// at a constant rate
+func steadyScore(rate, halfLifeSecs float64) float64 {
+	return rate * halfLifeSecs / math.Ln2
+}
+
+func TestDelayFor(t *testing.T) {
+	tests := []struct {
+		name  string
+		conf  Conf
+		score float64
+		want  time.Duration
+	}{
+		{
+			name:  "linear below threshold",
+			conf:  Conf{Curve: CurveLinear, ThresholdScore: 10, LinearMsPerPoint: 5, MaxDelayMs: 1000},
+			score: 9,
+			want:  0,
+		},
+		{
+			name:  "linear above threshold",
+			conf:  Conf{Curve: CurveLinear, ThresholdScore: 10, LinearMsPerPoint: 5, MaxDelayMs: 1000},
+			score: 30,
+			want:  100 * time.Millisecond,
+		},
+		{
+			name:  "linear capped",
+			conf:  Conf{Curve: CurveLinear, ThresholdScore: 10, LinearMsPerPoint: 5, MaxDelayMs: 1000},
+			score: 1000,
+			want:  time.Second,
+		},
+		{
+			name:  "exponential",
+			conf:  Conf{Curve: CurveExponential, ThresholdScore: 10, ExpBaseMs: 10, ExpFactor: 2, MaxDelayMs: 5000},
+			score: 13,
+			want:  70 * time.Millisecond,
+		},
+		{
+			name:  "exponential capped",
+			conf:  Conf{Curve: CurveExponential, ThresholdScore: 10, ExpBaseMs: 10, ExpFactor: 2, MaxDelayMs: 5000},
+			score: 100,
+			want:  5 * time.Second,
+		},
+		{
+			name: "step below first",
+			conf: Conf{
+				Curve: CurveStep, MaxDelayMs: 3000,
+				Steps: []Step{{MinScore: 50, DelayMs: 2000}, {MinScore: 20, DelayMs: 500}},
+			},
+			score: 19,
+			want:  0,
+		},
+		{
+			name: "step middle",
+			conf: Conf{
+				Curve: CurveStep, MaxDelayMs: 3000,
+				Steps: []Step{{MinScore: 50, DelayMs: 2000}, {MinScore: 20, DelayMs: 500}},
+			},
+			score: 49,
+			want:  500 * time.Millisecond,
+		},
+		{
+			name: "step highest",
+			conf: Conf{
+				Curve: CurveStep, MaxDelayMs: 1500,
+				Steps: []Step{{MinScore: 50, DelayMs: 2000}, {MinScore: 20, DelayMs: 500}},
+			},
+			score: 60,
+			want:  1500 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := mustConf(t, tt.conf)
+			if got := conf.DelayFor(tt.score); got != tt.want {
+				t.Errorf("DelayFor(%v) = %v, want %v", tt.score, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyntheticTraffic(t *testing.T) {
+	linear := Conf{
+		HalfLifeSecs:     60,
+		Curve:            CurveLinear,
+		ThresholdScore:   20,
+		LinearMsPerPoint: 5,
+		MaxDelayMs:       2000,
+	}
+	tests := []struct {
+		name     string
+		conf     Conf
+		rate     float64
+		duration time.Duration
+		minDelay time.Duration
+		maxDelay time.Duration
+	}{
+		{
+			name:     "light client",
+			conf:     linear,
+			rate:     0.2,
+			duration: 20 * time.Minute,
+			minDelay: 0,
+			maxDelay: 0,
+		},
+		{
+			name:     "moderate client",
+			conf:     linear,
+			rate:     1,
+			duration: 20 * time.Minute,
+			// steady score ~86.6 => ~333ms
+			minDelay: 320 * time.Millisecond,
+			maxDelay: 340 * time.Millisecond,
+		},
+		{
+			name:     "heavy client",
+			conf:     linear,
+			rate:     20,
+			duration: 10 * time.Minute,
+			minDelay: 2 * time.Second,
+			maxDelay: 2 * time.Second,
+		},
+		{
+			name: "short burst of otherwise heavy client",
+			conf: linear,
+			rate: 20,
+			// 10 requests only
+			duration: 500 * time.Millisecond,
+			minDelay: 0,
+			maxDelay: 0,
+		},
+		{
+			name: "step curve",
+			conf: Conf{
+				HalfLifeSecs: 10,
+				Curve:        CurveStep,
+				MaxDelayMs:   5000,
+				Steps:        []Step{{MinScore: 10, DelayMs: 100}, {MinScore: 100, DelayMs: 1000}},
+			},
+			rate:     5,
+			duration: 5 * time.Minute,
+			// steady score ~72
+			minDelay: 100 * time.Millisecond,
+			maxDelay: 100 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calc := NewCalculator(mustConf(t, tt.conf), nil)
+			client := common.ClientID{IP: "192.168.1.10", ID: common.InvalidUserID}
+			got, _ := simulateTraffic(t, calc, client, time.Now(), tt.rate, tt.duration)
+			if got < tt.minDelay || got > tt.maxDelay {
+				t.Errorf("delay = %v, want [%v, %v]", got, tt.minDelay, tt.maxDelay)
+			}
+		})
+	}
+}
+
+func TestScoreConvergence(t *testing.T) {
+	conf := mustConf(t, Conf{HalfLifeSecs: 30, Curve: CurveLinear, LinearMsPerPoint: 1, MaxDelayMs: 100000})
+	calc := NewCalculator(conf, nil)
+	client := common.ClientID{IP: "192.168.1.10", ID: common.InvalidUserID}
+	delay, _ := simulateTraffic(t, calc, client, time.Now(), 2, 10*time.Minute)
+	want := steadyScore(2, 30)
+	got := float64(delay) / float64(time.Millisecond)
+	if math.Abs(got-want)/want > 0.02 {
+		t.Errorf("score = %v, want approx. %v", got, want)
+	}
+}
+
+func TestDelayDecaysAfterIdle(t *testing.T) {
+	conf := mustConf(t, Conf{HalfLifeSecs: 60, Curve: CurveLinear, ThresholdScore: 10, LinearMsPerPoint: 10, MaxDelayMs: 5000})
+	calc := NewCalculator(conf, nil)
+	client := common.ClientID{IP: "192.168.1.10", ID: common.InvalidUserID}
+	delay, end := simulateTraffic(t, calc, client, time.Now(), 5, 5*time.Minute)
+	if delay == 0 {
+		t.Fatalf("expected a non-zero delay for a heavy client")
+	}
+	delay, err := calc.CalcDelayAt(client, end.Add(20*time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if delay != 0 {
+		t.Errorf("delay after idle period = %v, want 0", delay)
+	}
+}
+
+func TestClientsAreIndependent(t *testing.T) {
+	conf := mustConf(t, Conf{HalfLifeSecs: 60, Curve: CurveLinear, ThresholdScore: 10, LinearMsPerPoint: 10, MaxDelayMs: 5000})
+	calc := NewCalculator(conf, nil)
+	heavy := common.ClientID{IP: "192.168.1.10", ID: common.InvalidUserID}
+	light := common.ClientID{IP: "192.168.1.11", ID: common.InvalidUserID}
+	_, end := simulateTraffic(t, calc, heavy, time.Now(), 10, time.Minute)
+	delay, err := calc.CalcDelayAt(light, end)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if delay != 0 {
+		t.Errorf("delay of a light client = %v, want 0", delay)
+	}
+}
+
+func TestMemoryStoreEvictsIdleClients(t *testing.T) {
+	store := NewMemoryStore(time.Second, nil)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		client := common.ClientID{IP: "192.168.1.10", ID: common.UserID(i)}
+		if _, err := store.RegisterRequest(client, now); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if n := store.NumClients(); n != 100 {
+		t.Fatalf("NumClients() = %d, want 100", n)
+	}
+	client := common.ClientID{IP: "192.168.1.10", ID: common.UserID(1000)}
+	if _, err := store.RegisterRequest(client, now.Add(2*sweepInterval)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := store.NumClients(); n != 1 {
+		t.Errorf("NumClients() after sweep = %d, want 1", n)
+	}
+}
+
+// -----
+
+type telemetryStub struct {
+	telemetry.Storage
+	delays []time.Duration
+}
+
+func (ts *telemetryStub) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	ts.delays = append(ts.delays, respDelay)
+	return nil
+}
+
+func TestTelemetryStore(t *testing.T) {
+	conf := mustConf(t, Conf{HalfLifeSecs: 60, Curve: CurveLinear, LinearMsPerPoint: 10, MaxDelayMs: 5000})
+	db := &telemetryStub{}
+	calc := NewCalculator(conf, NewTelemetryStore(conf.HalfLife(), db))
+	client := common.ClientID{IP: "192.168.1.10", ID: common.InvalidUserID}
+	delay, _ := simulateTraffic(t, calc, client, time.Now(), 1, 10*time.Second)
+	if err := calc.LogAppliedDelay(delay, client); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(db.delays) != 1 || db.delays[0] != delay {
+		t.Errorf("logged delays = %v, want [%v]", db.delays, delay)
+	}
+}
@@ -1,8 +1,12 @@
 package guard
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/czcorpus/apiguard-common/common"
@@ -10,6 +14,50 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// DecisionReason is a machine-readable reason of a guard decision
+type DecisionReason string
+
+const (
+	ReasonNone               DecisionReason = ""
+	ReasonBannedIP           DecisionReason = "banned_ip"
+	ReasonBannedSession      DecisionReason = "banned_session"
+	ReasonDenylistedIP       DecisionReason = "denylisted_ip"
+	ReasonRateLimited        DecisionReason = "rate_limited"
+	ReasonConcurrencyLimited DecisionReason = "concurrency_limited"
+	ReasonQuotaExceeded      DecisionReason = "quota_exceeded"
+	ReasonUnauthenticated    DecisionReason = "unauthenticated"
+	ReasonInsufficientScope  DecisionReason = "insufficient_scope"
+	ReasonInvalidSession     DecisionReason = "invalid_session"
+	ReasonBotLike            DecisionReason = "bot_like"
+	ReasonChallengeRequired  DecisionReason = "challenge_required"
+	ReasonInternalError      DecisionReason = "internal_error"
+)
+
+// Message returns a generic client-facing message for the reason.
+// Unlike ReqEvaluation.Error, it does not expose any internal details.
+func (dr DecisionReason) Message() string {
+	switch dr {
+	case ReasonBannedIP, ReasonBannedSession, ReasonDenylistedIP, ReasonBotLike:
+		return "access denied"
+	case ReasonRateLimited, ReasonConcurrencyLimited:
+		return "too many requests"
+	case ReasonQuotaExceeded:
+		return "quota exceeded"
+	case ReasonUnauthenticated:
+		return "authentication required"
+	case ReasonInsufficientScope:
+		return "insufficient permissions"
+	case ReasonInvalidSession:
+		return "invalid session"
+	case ReasonChallengeRequired:
+		return "challenge required"
+	default:
+		return ""
+	}
+}
+
+// -----------
+
 type ReqEvaluation struct {
 	// ClientID is a user ID used to access the API
 	// In general it can be true user ID or some replacement
@@ -23,6 +71,10 @@ type ReqEvaluation struct {
 	ProposedResponse int
 	Error            error
 
+	// Reason provides a machine-readable reason of the decision.
+	// It should be set at least for responses >= 400.
+	Reason DecisionReason
+
 	// RequiresFallbackCookie can be set by an evaluation process
 	// in case it succeeded to authenticate request against
 	// the backend using the fallback (aka "one cookie for all")
@@ -34,12 +86,57 @@ type ReqEvaluation struct {
 	// Note that the 'true' value does not imply the evalutation
 	// will propose status 200.
 	RequiresFallbackCookie bool
+
+	// RetryAfter may be set in case the ProposedResponse is
+	// 429 or 503 to tell the client when to try again.
+	RetryAfter time.Duration
+
+	// ResponseHeaders contains optional headers which should be sent
+	// to the client along with the ProposedResponse (e.g. WWW-Authenticate)
+	ResponseHeaders http.Header
+
+	// Release, if set, must be called once the request is completely
+	// handled (no matter whether it was allowed or not) so the guard
+	// can free any resources reserved for the request (e.g. concurrency slots).
+	// Use ReleaseResources() for a nil-safe call.
+	Release func()
+
+	// DecidedBy contains a name of a guard which made the decision.
+	// This is mostly relevant for composite guards (see Chain).
+	DecidedBy string
 }
 
 func (rp ReqEvaluation) ForbidsAccess() bool {
 	return rp.ProposedResponse >= 400 && rp.ProposedResponse < 500
 }
 
+// WriteHeaders writes ResponseHeaders and (if set) the Retry-After
+// header to the response. It must be called before writing the status.
+func (rp ReqEvaluation) WriteHeaders(w http.ResponseWriter) {
+	for k, v := range rp.ResponseHeaders {
+		for _, item := range v {
+			w.Header().Add(k, item)
+		}
+	}
+	if rp.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rp.RetryAfter.Seconds()))))
+	}
+}
+
+// ReleaseResources calls the Release hook (if defined)
+func (rp ReqEvaluation) ReleaseResources() {
+	if rp.Release != nil {
+		rp.Release()
+	}
+}
+
+// -----------
+
+// UserIDResolver determines a user ID of a request. In case
+// the user cannot be determined, common.InvalidUserID should be returned.
+// It is used by guards which do not authenticate users by themselves.
+type UserIDResolver func(req *http.Request) (common.UserID, error)
+
 // -----------
 
 // ServiceGuard is an object which helps a proxy to decide
@@ -71,12 +168,76 @@ type ServiceGuard interface {
 	DetermineTrueUserID(req *http.Request) (common.UserID, error)
 }
 
+// ErrDelayAborted is returned by RestrictResponseTimeCtx in case
+// the applied delay has been interrupted by a cancelled context
+// (either the client disconnected or the application is shutting down).
+var ErrDelayAborted = errors.New("response delay aborted")
+
+// IsDelayAborted tests whether the error (or any wrapped error)
+// is ErrDelayAborted
+func IsDelayAborted(err error) bool {
+	return errors.Is(err, ErrDelayAborted)
+}
+
+// AbortedDelayLogger is an optional interface a ServiceGuard may implement
+// to be notified about delays which have not been applied in full
+// (see RestrictResponseTimeCtx). As such delays have been already passed
+// to ServiceGuard.LogAppliedDelay, the guard can correct its records
+// based on the actually applied delay.
+type AbortedDelayLogger interface {
+	LogAbortedDelay(respDelay, appliedDelay time.Duration, clientID common.ClientID) error
+}
+
+func logAbortedDelay(
+	guard ServiceGuard,
+	respDelay time.Duration,
+	t0 time.Time,
+	client common.ClientID,
+	msg string,
+) {
+	appliedDelay := time.Since(t0)
+	log.Info().
+		Str("clientId", client.GetKey()).
+		Dur("delay", respDelay).
+		Dur("appliedDelay", appliedDelay).
+		Msg(msg)
+	if adl, ok := guard.(AbortedDelayLogger); ok {
+		if err := adl.LogAbortedDelay(respDelay, appliedDelay, client); err != nil {
+			log.Error().Err(err).Str("clientId", client.GetKey()).Msg("failed to log aborted delay")
+		}
+	}
+}
+
+// RestrictResponseTime calculates and applies a delay for the request.
+// It is equivalent to RestrictResponseTimeCtx with context.Background()
+// i.e. the delay is interrupted only by a disconnected client.
 func RestrictResponseTime(
 	w http.ResponseWriter,
 	req *http.Request,
 	readTimeoutSecs int,
 	guard ServiceGuard,
 	client common.ClientID,
+) error {
+	return RestrictResponseTimeCtx(context.Background(), w, req, readTimeoutSecs, guard, client)
+}
+
+// RestrictResponseTimeCtx calculates and applies a delay for the request.
+// The delay is passed to ServiceGuard.LogAppliedDelay before waiting so
+// concurrent requests of the same client can take it into account (a failure
+// to log the delay is not fatal). The delay is interrupted in case either
+// the request context or the ctx (typically the global application context)
+// is cancelled. In such case, an error wrapping ErrDelayAborted is returned
+// and the actually applied delay is passed to AbortedDelayLogger
+// (if implemented by the guard).
+// For a disconnected client, nothing is written to w. For a cancelled ctx
+// (i.e. the application is shutting down), 503 is always written.
+func RestrictResponseTimeCtx(
+	ctx context.Context,
+	w http.ResponseWriter,
+	req *http.Request,
+	readTimeoutSecs int,
+	guard ServiceGuard,
+	client common.ClientID,
 ) error {
 	respDelay, err := guard.CalcDelay(req, client)
 	if err != nil {
@@ -89,22 +250,36 @@ func RestrictResponseTime(
 	}
 	log.Debug().Msgf("Client is going to wait for %v", respDelay)
 	if respDelay.Seconds() >= float64(readTimeoutSecs) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(respDelay.Seconds()))))
 		uniresp.WriteJSONErrorResponse(
 			w,
 			uniresp.NewActionError("service overloaded"),
 			http.StatusServiceUnavailable,
 		)
-		return fmt.Errorf("failed to restrict response time: %w", err)
+		return fmt.Errorf(
+			"failed to restrict response time: delay %v exceeds read timeout %ds", respDelay, readTimeoutSecs)
 	}
 	if err := guard.LogAppliedDelay(respDelay, client); err != nil {
-		uniresp.WriteJSONErrorResponse(
-			w,
-			uniresp.NewActionError("service handling error: %s", err),
-			http.StatusInternalServerError,
-		)
-		return fmt.Errorf("failed to restrict response time: %w", err)
+		log.Error().Err(err).Str("clientId", client.GetKey()).Msg("failed to log applied delay")
+	}
+	if respDelay > 0 {
+		t0 := time.Now()
+		timer := time.NewTimer(respDelay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			logAbortedDelay(guard, respDelay, t0, client, "response delay aborted - client disconnected")
+			return fmt.Errorf("failed to restrict response time (client disconnected): %w", ErrDelayAborted)
+		case <-ctx.Done():
+			logAbortedDelay(guard, respDelay, t0, client, "response delay aborted - application is shutting down")
+			uniresp.WriteJSONErrorResponse(
+				w,
+				uniresp.NewActionError("service is shutting down"),
+				http.StatusServiceUnavailable,
+			)
+			return fmt.Errorf("failed to restrict response time (shutdown): %w", ErrDelayAborted)
+		}
 	}
-	time.Sleep(respDelay)
 	return nil
 }
-
@@ -0,0 +1,132 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package guardtest provides a conformance test suite and request
+// fixtures for guard.ServiceGuard implementations.
+package guardtest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/logging"
+)
+
+const (
+	// UserIDHeader is a request header recognized by ResolveUserID
+	UserIDHeader = "X-Api-Key"
+
+	// AuthenticatedUserID is a user ID returned by ResolveUserID
+	// for requests with the UserIDHeader
+	AuthenticatedUserID common.UserID = 42
+)
+
+// ResolveUserID is a guard.UserIDResolver stub for tests. Requests with
+// a non-empty UserIDHeader belong to AuthenticatedUserID, other requests
+// have no valid user ID.
+func ResolveUserID(req *http.Request) (common.UserID, error) {
+	if req.Header.Get(UserIDHeader) != "" {
+		return AuthenticatedUserID, nil
+	}
+	return common.InvalidUserID, nil
+}
+
+// Fixture is a named request factory. A new request is created
+// for each use as requests cannot be safely reused.
+type Fixture struct {
+	Name       string
+	NewRequest func() *http.Request
+}
+
+// NewRequest creates a GET request from the specified client IP address
+// (RemoteAddr with a port is used just like in a real server).
+func NewRequest(url, clientIP string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.RemoteAddr = net.JoinHostPort(clientIP, "54321")
+	return req
+}
+
+// DefaultFixtures returns a set of requests covering typical
+// variants of clients (IPv4/IPv6, proxies, cookies, missing data).
+func DefaultFixtures() []Fixture {
+	return []Fixture{
+		{
+			Name: "plain IPv4 client",
+			NewRequest: func() *http.Request {
+				return NewRequest("/api/query?q=test", "192.0.2.10")
+			},
+		},
+		{
+			Name: "plain IPv6 client",
+			NewRequest: func() *http.Request {
+				return NewRequest("/api/query?q=test", "2001:db8::10")
+			},
+		},
+		{
+			Name: "client behind proxy",
+			NewRequest: func() *http.Request {
+				req := NewRequest("/api/query", "10.0.0.1")
+				req.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.1")
+				return req
+			},
+		},
+		{
+			Name: "client with session cookie",
+			NewRequest: func() *http.Request {
+				req := NewRequest("/api/query", "192.0.2.11")
+				req.AddCookie(&http.Cookie{Name: logging.WaGSessionName, Value: "foo.bar.baz"})
+				return req
+			},
+		},
+		{
+			Name: "client with API key and bearer token",
+			NewRequest: func() *http.Request {
+				req := NewRequest("/api/query", "192.0.2.12")
+				req.Header.Set("X-Api-Key", "invalid-key")
+				req.Header.Set("Authorization", "Bearer invalid.token.value")
+				return req
+			},
+		},
+		{
+			Name: "bot-like user agent",
+			NewRequest: func() *http.Request {
+				req := NewRequest("/api/query", "203.0.113.5")
+				req.Header.Set("User-Agent", "python-requests/2.31.0")
+				return req
+			},
+		},
+		{
+			Name: "missing client address",
+			NewRequest: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/api/query", nil)
+				req.RemoteAddr = ""
+				return req
+			},
+		},
+		{
+			Name: "POST request with body",
+			NewRequest: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/api/query", nil)
+				req.RemoteAddr = "192.0.2.13:54321"
+				req.Header.Set("Content-Type", "application/json")
+				return req
+			},
+		},
+	}
+}
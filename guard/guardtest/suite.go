@@ -0,0 +1,225 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guardtest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+)
+
+const (
+	dfltParallelism = 8
+	dfltIterations  = 50
+)
+
+// Suite configures the conformance suite. Only Guard is required.
+//
+// Typical use:
+//
+//	func TestConformance(t *testing.T) {
+//		guardtest.Run(t, guardtest.Suite{Guard: myguard.NewGuard(...)})
+//	}
+type Suite struct {
+	Guard guard.ServiceGuard
+
+	// AnonymousUsers should contain the same IDs the guard has been
+	// configured with. In case it is nil, the anonymous users check
+	// is skipped (i.e. for guards not working with user IDs).
+	AnonymousUsers common.AnonymousUsers
+
+	// Fixtures are requests used in checks. DefaultFixtures() are used
+	// in case it is nil.
+	Fixtures []Fixture
+
+	// Parallelism is a number of goroutines used in the concurrency check
+	Parallelism int
+
+	// Iterations is a number of evaluations per goroutine
+	// in the concurrency check
+	Iterations int
+
+	// SkipConcurrency disables the concurrency check
+	SkipConcurrency bool
+}
+
+func (s *Suite) fixtures() []Fixture {
+	if s.Fixtures == nil {
+		return DefaultFixtures()
+	}
+	return s.Fixtures
+}
+
+// -----
+
+// CheckEvaluation tests consistency of a single ReqEvaluation.
+func CheckEvaluation(t testing.TB, eval guard.ReqEvaluation) {
+	t.Helper()
+	status := eval.ProposedResponse
+	if status < 100 || status > 599 {
+		t.Errorf("ProposedResponse %d is not a valid HTTP status", status)
+	}
+	if eval.ForbidsAccess() != (status >= 400 && status < 500) {
+		t.Errorf("ForbidsAccess() = %v inconsistent with status %d", eval.ForbidsAccess(), status)
+	}
+	if status >= 400 && eval.Reason == guard.ReasonNone {
+		t.Errorf("rejecting status %d without a Reason", status)
+	}
+	if status < 400 && eval.Reason != guard.ReasonNone {
+		t.Errorf("passing status %d with Reason %s", status, eval.Reason)
+	}
+	if status < 400 && eval.Error != nil {
+		t.Errorf("passing status %d with Error %v", status, eval.Error)
+	}
+	if status >= 500 && eval.Error == nil {
+		t.Errorf("server error status %d without an Error", status)
+	}
+	if eval.RetryAfter < 0 {
+		t.Errorf("negative RetryAfter %v", eval.RetryAfter)
+	}
+	if status < 400 && eval.RetryAfter > 0 {
+		t.Errorf("passing status %d with RetryAfter %v", status, eval.RetryAfter)
+	}
+}
+
+func checkEvaluations(t *testing.T, s *Suite) {
+	for _, fx := range s.fixtures() {
+		t.Run(fx.Name, func(t *testing.T) {
+			eval := s.Guard.EvaluateRequest(fx.NewRequest(), nil)
+			// releasing must be idempotent
+			defer eval.ReleaseResources()
+			defer eval.ReleaseResources()
+			CheckEvaluation(t, eval)
+		})
+	}
+}
+
+func checkDelays(t *testing.T, s *Suite) {
+	for _, fx := range s.fixtures() {
+		t.Run(fx.Name, func(t *testing.T) {
+			req := fx.NewRequest()
+			userID, _ := s.Guard.DetermineTrueUserID(req)
+			clientID := common.ClientID{IP: guard.ClientIPString(req), ID: userID}
+			delay, err := s.Guard.CalcDelay(req, clientID)
+			if err != nil {
+				t.Errorf("CalcDelay failed: %v", err)
+				return
+			}
+			if delay < 0 {
+				t.Errorf("negative delay %v", delay)
+			}
+			if err := s.Guard.LogAppliedDelay(delay, clientID); err != nil {
+				t.Errorf("LogAppliedDelay failed: %v", err)
+			}
+		})
+	}
+}
+
+func checkUserIDs(t *testing.T, s *Suite) {
+	for _, fx := range s.fixtures() {
+		t.Run(fx.Name, func(t *testing.T) {
+			userID, err := s.Guard.DetermineTrueUserID(fx.NewRequest())
+			if err != nil && userID.IsValid() {
+				t.Errorf("DetermineTrueUserID returned both a valid ID %s and an error %v", userID, err)
+			}
+		})
+	}
+}
+
+func checkAnonymousUsers(t *testing.T, s *Suite) {
+	maxID := common.UserID(0)
+	for _, uid := range s.AnonymousUsers {
+		if !s.Guard.TestUserIsAnonymous(uid) {
+			t.Errorf("user %s expected to be anonymous", uid)
+		}
+		maxID = max(maxID, uid)
+	}
+	if nonAnon := maxID + 1; s.Guard.TestUserIsAnonymous(nonAnon) {
+		t.Errorf("user %s not expected to be anonymous", nonAnon)
+	}
+}
+
+func checkConcurrency(t *testing.T, s *Suite) {
+	parallelism := s.Parallelism
+	if parallelism <= 0 {
+		parallelism = dfltParallelism
+	}
+	iterations := s.Iterations
+	if iterations <= 0 {
+		iterations = dfltIterations
+	}
+	fixtures := s.fixtures()
+	var wg sync.WaitGroup
+	errs := make(chan string, parallelism)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs <- "panic during concurrent evaluation"
+				}
+			}()
+			for j := 0; j < iterations; j++ {
+				req := fixtures[(worker+j)%len(fixtures)].NewRequest()
+				eval := s.Guard.EvaluateRequest(req, nil)
+				eval.ReleaseResources()
+				userID, _ := s.Guard.DetermineTrueUserID(req)
+				clientID := common.ClientID{IP: guard.ClientIPString(req), ID: userID}
+				if delay, err := s.Guard.CalcDelay(req, clientID); err == nil && delay >= 0 {
+					s.Guard.LogAppliedDelay(delay, clientID)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error(e)
+	}
+}
+
+// Run runs the conformance suite. For the concurrency check to be
+// meaningful, tests should be run with the -race flag.
+func Run(t *testing.T, s Suite) {
+	t.Helper()
+	if s.Guard == nil {
+		t.Fatal("Suite.Guard is missing")
+	}
+	checks := []struct {
+		name string
+		skip bool
+		fn   func(t *testing.T, s *Suite)
+	}{
+		{name: "Evaluations", fn: checkEvaluations},
+		{name: "Delays", fn: checkDelays},
+		{name: "UserIDs", fn: checkUserIDs},
+		{name: "AnonymousUsers", fn: checkAnonymousUsers, skip: s.AnonymousUsers == nil},
+		{name: "Concurrency", fn: checkConcurrency, skip: s.SkipConcurrency},
+	}
+	for _, check := range checks {
+		t.Run(check.name, func(t *testing.T) {
+			if check.skip {
+				t.Skip("disabled by the suite configuration")
+			}
+			check.fn(t, &s)
+		})
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package iplist provides a guard based on CIDR allow/deny lists
+package iplist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltReloadIntervalSecs = 30
+)
+
+// Conf configures IP allow/deny lists. Each file contains one
+// IPv4/IPv6 CIDR (or a plain IP address) per line. Empty lines
+// and lines starting with '#' are ignored.
+type Conf struct {
+	AllowlistPaths     []string `json:"allowlistPaths"`
+	DenylistPaths      []string `json:"denylistPaths"`
+	ReloadIntervalSecs int      `json:"reloadIntervalSecs"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if len(conf.AllowlistPaths) == 0 && len(conf.DenylistPaths) == 0 {
+		return fmt.Errorf("%s: at least one allowlist or denylist must be defined", context)
+	}
+	if conf.ReloadIntervalSecs == 0 {
+		conf.ReloadIntervalSecs = dfltReloadIntervalSecs
+	}
+	if conf.ReloadIntervalSecs < 0 {
+		return fmt.Errorf("%s.reloadIntervalSecs cannot be negative", context)
+	}
+	return nil
+}
+
+// -----
+
+// loadList loads all the files into a single trie
+func loadList(paths []string) (*PrefixTrie, error) {
+	ans := NewPrefixTrie()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load IP list %s: %w", path, err)
+		}
+		scanner := bufio.NewScanner(f)
+		lineNum := 0
+		for scanner.Scan() {
+			lineNum++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			prefix, err := common.ParseIPPrefix(line)
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("failed to load IP list %s, line %d: %w", path, lineNum, err)
+			}
+			ans.Insert(prefix)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load IP list %s: %w", path, err)
+		}
+	}
+	return ans, nil
+}
+
+// -----
+
+// Guard allows or denies requests based on CIDR lists. Allowlisted
+// clients bypass the remaining guards in a guard.Chain (see guard.Bypasser),
+// denylisted ones receive 403. Other clients are passed.
+// The lists are reloaded once any of the files changes (see Run).
+type Guard struct {
+	conf      *Conf
+	allowlist *PrefixTrie
+	denylist  *PrefixTrie
+	mtimes    map[string]time.Time
+	mu        sync.RWMutex
+}
+
+func (g *Guard) fileMtimes() map[string]time.Time {
+	ans := make(map[string]time.Time)
+	for _, path := range slices.Concat(g.conf.AllowlistPaths, g.conf.DenylistPaths) {
+		if st, err := os.Stat(path); err == nil {
+			ans[path] = st.ModTime()
+		}
+	}
+	return ans
+}
+
+// Reload loads all the lists. In case of an error, the previous
+// lists are kept.
+func (g *Guard) Reload() error {
+	mtimes := g.fileMtimes()
+	allowlist, err := loadList(g.conf.AllowlistPaths)
+	if err != nil {
+		return err
+	}
+	denylist, err := loadList(g.conf.DenylistPaths)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.allowlist = allowlist
+	g.denylist = denylist
+	g.mtimes = mtimes
+	g.mu.Unlock()
+	log.Info().
+		Int("allowlistSize", allowlist.Size()).
+		Int("denylistSize", denylist.Size()).
+		Msg("loaded IP allow/deny lists")
+	return nil
+}
+
+func (g *Guard) hasChanged() bool {
+	curr := g.fileMtimes()
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if len(curr) != len(g.mtimes) {
+		return true
+	}
+	for path, mt := range curr {
+		if !g.mtimes[path].Equal(mt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run periodically checks the list files and reloads them
+// in case of a change. The function blocks until ctx is cancelled.
+func (g *Guard) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(g.conf.ReloadIntervalSecs) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("stopping IP list watcher")
+			return
+		case <-ticker.C:
+			if g.hasChanged() {
+				if err := g.Reload(); err != nil {
+					log.Error().Err(err).Msg("failed to reload IP lists, keeping the previous ones")
+				}
+			}
+		}
+	}
+}
+
+// IsAllowlisted tests whether the address belongs to the allowlist
+func (g *Guard) IsAllowlisted(addr netip.Addr) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.allowlist.Contains(addr)
+}
+
+// IsDenylisted tests whether the address belongs to the denylist
+func (g *Guard) IsDenylisted(addr netip.Addr) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.denylist.Contains(addr)
+}
+
+// BypassesChain exempts allowlisted clients from the rest of the guard
+// chain. Requests with forwarding headers from an untrusted peer
+// (see guard.HasUntrustedForwarding) never bypass the chain.
+func (g *Guard) BypassesChain(req *http.Request) bool {
+	if guard.HasUntrustedForwarding(req) {
+		return false
+	}
+	return g.IsAllowlisted(guard.ClientAddr(req))
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	ans := guard.ReqEvaluation{
+		ClientID:         common.InvalidUserID,
+		HumanID:          common.InvalidUserID,
+		ProposedResponse: http.StatusOK,
+	}
+	addr := guard.ClientAddr(req)
+	if !g.IsAllowlisted(addr) && g.IsDenylisted(addr) {
+		ans.ProposedResponse = http.StatusForbidden
+		ans.Reason = guard.ReasonDenylistedIP
+	}
+	return ans
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	return false
+}
+
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	return common.InvalidUserID, nil
+}
+
+// NewGuard validates the conf, creates a new IP list guard and loads the lists.
+// To enable hot reloading, Run must be called.
+func NewGuard(conf *Conf) (*Guard, error) {
+	if err := conf.ValidateAndDefaults("iplist"); err != nil {
+		return nil, fmt.Errorf("failed to create IP list guard: %w", err)
+	}
+	ans := &Guard{
+		conf:      conf,
+		allowlist: NewPrefixTrie(),
+		denylist:  NewPrefixTrie(),
+	}
+	if err := ans.Reload(); err != nil {
+		return nil, fmt.Errorf("failed to create IP list guard: %w", err)
+	}
+	return ans, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iplist
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+)
+
+func writeList(t *testing.T, name string, lines string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestGuard(t *testing.T) *Guard {
+	t.Helper()
+	conf := &Conf{
+		AllowlistPaths: []string{writeList(t, "allow.txt", "192.0.2.10\n203.0.113.77\n2001:db8::/32\n")},
+		DenylistPaths:  []string{writeList(t, "deny.txt", "# bots\n203.0.113.0/24\n2001:db9:bad::/48\n")},
+	}
+	g, err := NewGuard(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestConformance(t *testing.T) {
+	guardtest.Run(t, guardtest.Suite{Guard: newTestGuard(t)})
+}
+
+func TestDenylist(t *testing.T) {
+	g := newTestGuard(t)
+	tests := []struct {
+		clientIP  string
+		expStatus int
+	}{
+		{clientIP: "203.0.113.5", expStatus: http.StatusForbidden},
+		{clientIP: "203.0.113.77", expStatus: http.StatusOK}, // allowlist takes precedence
+		{clientIP: "198.51.100.1", expStatus: http.StatusOK},
+		{clientIP: "2001:db8::1", expStatus: http.StatusOK},
+		{clientIP: "2001:db9:bad::1", expStatus: http.StatusForbidden},
+		{clientIP: "2001:db9::1", expStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.clientIP, func(t *testing.T) {
+			eval := g.EvaluateRequest(guardtest.NewRequest("/", tt.clientIP), nil)
+			if eval.ProposedResponse != tt.expStatus {
+				t.Fatalf("expected status %d, got %d", tt.expStatus, eval.ProposedResponse)
+			}
+			if tt.expStatus == http.StatusForbidden && eval.Reason != guard.ReasonDenylistedIP {
+				t.Errorf("expected reason %s, got %s", guard.ReasonDenylistedIP, eval.Reason)
+			}
+		})
+	}
+}
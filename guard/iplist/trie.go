@@ -0,0 +1,124 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iplist
+
+import (
+	"net/netip"
+)
+
+type trieNode struct {
+	children [2]*trieNode
+	terminal bool
+}
+
+// PrefixTrie is a binary trie of network prefixes allowing
+// for fast "is the IP within any of the networks" tests.
+// IPv4 and IPv6 prefixes are stored separately. IPv4-mapped IPv6
+// addresses are matched as IPv4.
+// PrefixTrie is not safe for concurrent modification but it can be
+// safely read concurrently once built.
+type PrefixTrie struct {
+	v4   *trieNode
+	v6   *trieNode
+	size int
+}
+
+// countTerminals returns number of prefixes stored in the subtree
+func countTerminals(node *trieNode) int {
+	if node == nil {
+		return 0
+	}
+	ans := countTerminals(node.children[0]) + countTerminals(node.children[1])
+	if node.terminal {
+		ans++
+	}
+	return ans
+}
+
+func bitAt(addr []byte, i int) int {
+	return int(addr[i/8]>>(7-uint(i%8))) & 1
+}
+
+func (pt *PrefixTrie) root(addr netip.Addr) *trieNode {
+	if addr.Is4() {
+		return pt.v4
+	}
+	return pt.v6
+}
+
+// Insert adds a network prefix to the trie
+func (pt *PrefixTrie) Insert(prefix netip.Prefix) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr().Unmap()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4In6() {
+		bits = max(bits-96, 0)
+	}
+	raw := addr.AsSlice()
+	node := pt.root(addr)
+	for i := 0; i < bits; i++ {
+		if node.terminal {
+			// a shorter prefix already covers this one
+			return
+		}
+		b := bitAt(raw, i)
+		if node.children[b] == nil {
+			node.children[b] = &trieNode{}
+		}
+		node = node.children[b]
+	}
+	if !node.terminal {
+		// longer prefixes are now redundant
+		pt.size -= countTerminals(node.children[0]) + countTerminals(node.children[1])
+		node.terminal = true
+		node.children = [2]*trieNode{}
+		pt.size++
+	}
+}
+
+// Contains tests whether the address belongs to any of the stored networks
+func (pt *PrefixTrie) Contains(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	raw := addr.AsSlice()
+	node := pt.root(addr)
+	for i := 0; i < addr.BitLen(); i++ {
+		if node.terminal {
+			return true
+		}
+		node = node.children[bitAt(raw, i)]
+		if node == nil {
+			return false
+		}
+	}
+	return node.terminal
+}
+
+// Size returns number of stored (non-redundant) prefixes
+func (pt *PrefixTrie) Size() int {
+	return pt.size
+}
+
+func NewPrefixTrie() *PrefixTrie {
+	return &PrefixTrie{
+		v4: &trieNode{},
+		v6: &trieNode{},
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwtauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// jwk is a JSON Web Key as found in a JWKS file. Only the properties
+// needed for HS256 (kty=oct), RS256 (kty=RSA) and EdDSA (kty=OKP, crv=Ed25519)
+// are supported.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// verificationKey is a parsed key ready for signature verification
+type verificationKey struct {
+	kid     string
+	alg     string
+	hmacKey []byte
+	rsaKey  *rsa.PublicKey
+	edKey   ed25519.PublicKey
+}
+
+func decodeB64(v string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(v)
+}
+
+func (k jwk) toVerificationKey() (*verificationKey, error) {
+	ans := &verificationKey{kid: k.Kid}
+	switch k.Kty {
+	case "oct":
+		secret, err := decodeB64(k.K)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oct key %s: %w", k.Kid, err)
+		}
+		ans.alg = AlgHS256
+		ans.hmacKey = secret
+	case "RSA":
+		n, err := decodeB64(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA key %s: %w", k.Kid, err)
+		}
+		e, err := decodeB64(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA key %s: %w", k.Kid, err)
+		}
+		ans.alg = AlgRS256
+		ans.rsaKey = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %s in key %s", k.Crv, k.Kid)
+		}
+		x, err := decodeB64(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ed25519 key %s: %w", k.Kid, err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %s: wrong key size", k.Kid)
+		}
+		ans.alg = AlgEdDSA
+		ans.edKey = ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("unsupported key type %s in key %s", k.Kty, k.Kid)
+	}
+	if k.Alg != "" && k.Alg != ans.alg {
+		return nil, fmt.Errorf("unsupported algorithm %s in key %s", k.Alg, k.Kid)
+	}
+	return ans, nil
+}
+
+// loadJWKS loads verification keys from a local JWKS file
+func loadJWKS(path string) ([]*verificationKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWKS file %s: %w", path, err)
+	}
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to load JWKS file %s: %w", path, err)
+	}
+	ans := make([]*verificationKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		vk, err := k.toVerificationKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWKS file %s: %w", path, err)
+		}
+		ans = append(ans, vk)
+	}
+	if len(ans) == 0 {
+		return nil, fmt.Errorf("failed to load JWKS file %s: no keys found", path)
+	}
+	return ans, nil
+}
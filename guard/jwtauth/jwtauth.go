@@ -0,0 +1,216 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jwtauth provides a guard authenticating requests
+// via signed JWT tokens (HS256, RS256, EdDSA).
+package jwtauth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+)
+
+const (
+	dfltUserIDClaim = "sub"
+	dfltRealm       = "apiguard"
+)
+
+var ErrMissingToken = errors.New("missing bearer token")
+
+// Conf configures JWT authentication
+type Conf struct {
+	JWKSPath string `json:"jwksPath"`
+
+	// Audience is a required value of the "aud" claim
+	Audience string `json:"audience"`
+
+	// Issuer is an optional required value of the "iss" claim
+	Issuer string `json:"issuer"`
+
+	// UserIDClaim is a claim containing a numeric user ID ("sub" by default)
+	UserIDClaim string `json:"userIdClaim"`
+
+	// LeewaySecs is a tolerance applied to "exp" and "nbf" claims
+	LeewaySecs int `json:"leewaySecs"`
+
+	// Realm is used in WWW-Authenticate response headers
+	Realm string `json:"realm"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if conf.JWKSPath == "" {
+		return fmt.Errorf("%s.jwksPath is missing", context)
+	}
+	if conf.Audience == "" {
+		return fmt.Errorf("%s.audience is missing", context)
+	}
+	if conf.UserIDClaim == "" {
+		conf.UserIDClaim = dfltUserIDClaim
+	}
+	if conf.LeewaySecs < 0 {
+		return fmt.Errorf("%s.leewaySecs cannot be negative", context)
+	}
+	if conf.Realm == "" {
+		conf.Realm = dfltRealm
+	}
+	return nil
+}
+
+// -----
+
+// Guard validates JWT bearer tokens against keys from a local JWKS file.
+// The user ID claim is used as ReqEvaluation.HumanID (and ClientID).
+type Guard struct {
+	conf           *Conf
+	keys           []*verificationKey
+	anonymousUsers common.AnonymousUsers
+	mu             sync.RWMutex
+}
+
+// Reload loads the JWKS file again. In case of an error,
+// the previous keys are kept.
+func (g *Guard) Reload() error {
+	keys, err := loadJWKS(g.conf.JWKSPath)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.keys = keys
+	g.mu.Unlock()
+	return nil
+}
+
+func extractBearer(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+func (g *Guard) userIDFromClaims(claims *Claims) (common.UserID, error) {
+	switch v := claims.Raw[g.conf.UserIDClaim].(type) {
+	case float64:
+		if v < 0 || v != math.Trunc(v) || v > math.MaxInt32 {
+			return common.InvalidUserID, fmt.Errorf("%w: invalid %s claim", ErrMalformedToken, g.conf.UserIDClaim)
+		}
+		return common.UserID(int(v)), nil
+	case string:
+		uid, err := strconv.Atoi(v)
+		if err != nil || uid < 0 {
+			return common.InvalidUserID, fmt.Errorf("%w: invalid %s claim", ErrMalformedToken, g.conf.UserIDClaim)
+		}
+		return common.UserID(uid), nil
+	}
+	return common.InvalidUserID, fmt.Errorf("%w: missing %s claim", ErrMalformedToken, g.conf.UserIDClaim)
+}
+
+// validate extracts and validates a request token
+func (g *Guard) validate(req *http.Request) (common.UserID, error) {
+	token := extractBearer(req)
+	if token == "" {
+		return common.InvalidUserID, ErrMissingToken
+	}
+	g.mu.RLock()
+	keys := g.keys
+	g.mu.RUnlock()
+	claims, err := parseAndVerify(
+		token,
+		keys,
+		g.conf.Audience,
+		g.conf.Issuer,
+		time.Duration(g.conf.LeewaySecs)*time.Second,
+		time.Now(),
+	)
+	if err != nil {
+		return common.InvalidUserID, err
+	}
+	return g.userIDFromClaims(claims)
+}
+
+// wwwAuthenticate creates a WWW-Authenticate header value. To avoid leaking
+// details about token validation, only a generic description is provided.
+func (g *Guard) wwwAuthenticate(err error) string {
+	if errors.Is(err, ErrMissingToken) {
+		return fmt.Sprintf("Bearer realm=%q", g.conf.Realm)
+	}
+	desc := "the access token is invalid"
+	if errors.Is(err, ErrTokenExpired) {
+		desc = "the access token expired"
+	}
+	return fmt.Sprintf(
+		"Bearer realm=%q, error=\"invalid_token\", error_description=%q", g.conf.Realm, desc)
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	userID, err := g.validate(req)
+	if err != nil {
+		return guard.ReqEvaluation{
+			ClientID:         common.InvalidUserID,
+			HumanID:          common.InvalidUserID,
+			ProposedResponse: http.StatusUnauthorized,
+			Reason:           guard.ReasonUnauthenticated,
+			Error:            err,
+			ResponseHeaders:  http.Header{"Www-Authenticate": []string{g.wwwAuthenticate(err)}},
+		}
+	}
+	return guard.ReqEvaluation{
+		ClientID:         userID,
+		HumanID:          userID,
+		ProposedResponse: http.StatusOK,
+	}
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	return g.anonymousUsers.IsAnonymous(userID)
+}
+
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	return g.validate(req)
+}
+
+// NewGuard creates a new JWT guard and loads keys from the JWKS file
+func NewGuard(conf *Conf, anonymousUsers common.AnonymousUsers) (*Guard, error) {
+	ans := &Guard{
+		conf:           conf,
+		anonymousUsers: anonymousUsers,
+	}
+	if err := ans.Reload(); err != nil {
+		return nil, fmt.Errorf("failed to create JWT guard: %w", err)
+	}
+	return ans, nil
+}
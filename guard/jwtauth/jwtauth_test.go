@@ -0,0 +1,414 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+)
+
+const testAudience = "apiguard-test"
+
+var hmacSecret = []byte("0123456789abcdef0123456789abcdef")
+
+type signer func(signingInput []byte) []byte
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func hs256Signer(secret []byte) signer {
+	return func(signingInput []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signingInput)
+		return mac.Sum(nil)
+	}
+}
+
+func rs256Signer(key *rsa.PrivateKey) signer {
+	return func(signingInput []byte) []byte {
+		h := sha256.Sum256(signingInput)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+		if err != nil {
+			panic(err)
+		}
+		return sig
+	}
+}
+
+func edDSASigner(key ed25519.PrivateKey) signer {
+	return func(signingInput []byte) []byte {
+		return ed25519.Sign(key, signingInput)
+	}
+}
+
+func makeToken(t *testing.T, hdr header, claims map[string]any, sign signer) string {
+	t.Helper()
+	rawHdr, err := json.Marshal(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawClaims, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := b64(rawHdr) + "." + b64(rawClaims)
+	return signingInput + "." + b64(sign([]byte(signingInput)))
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub": "42",
+		"aud": testAudience,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ed  ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKeys{rsa: rsaKey, ed: edKey}
+}
+
+func (tk testKeys) jwks() jwks {
+	return jwks{Keys: []jwk{
+		{Kty: "oct", Kid: "hs", K: b64(hmacSecret)},
+		{
+			Kty: "RSA",
+			Kid: "rs",
+			N:   b64(tk.rsa.N.Bytes()),
+			E:   b64(big.NewInt(int64(tk.rsa.E)).Bytes()),
+		},
+		{Kty: "OKP", Kid: "ed", Crv: "Ed25519", X: b64(tk.ed.Public().(ed25519.PublicKey))},
+	}}
+}
+
+func newTestGuard(t *testing.T, set jwks, leewaySecs int) *Guard {
+	t.Helper()
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	conf := &Conf{JWKSPath: path, Audience: testAudience, LeewaySecs: leewaySecs}
+	if err := conf.ValidateAndDefaults("jwtauth"); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGuard(conf, common.AnonymousUsers{0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func bearerRequest(token string) *http.Request {
+	req := guardtest.NewRequest("/api/query", "192.0.2.30")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// -----
+
+func TestSignatureAlgorithms(t *testing.T) {
+	keys := newTestKeys(t)
+	g := newTestGuard(t, keys.jwks(), 0)
+	tests := []struct {
+		name string
+		hdr  header
+		sign signer
+	}{
+		{name: "HS256", hdr: header{Alg: AlgHS256, Kid: "hs"}, sign: hs256Signer(hmacSecret)},
+		{name: "RS256", hdr: header{Alg: AlgRS256, Kid: "rs"}, sign: rs256Signer(keys.rsa)},
+		{name: "EdDSA", hdr: header{Alg: AlgEdDSA, Kid: "ed"}, sign: edDSASigner(keys.ed)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := makeToken(t, tt.hdr, validClaims(), tt.sign)
+			eval := g.EvaluateRequest(bearerRequest(token), nil)
+			if eval.ProposedResponse != http.StatusOK {
+				t.Fatalf("expected status 200, got %d (%v)", eval.ProposedResponse, eval.Error)
+			}
+			if eval.HumanID != 42 {
+				t.Errorf("expected user 42, got %s", eval.HumanID)
+			}
+
+			tampered := token[:len(token)-4] + "AAAA"
+			if _, err := g.validate(bearerRequest(tampered)); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("expected ErrInvalidSignature for a tampered token, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAlgorithmConfusion(t *testing.T) {
+	keys := newTestKeys(t)
+	set := keys.jwks()
+	set.Keys = set.Keys[1:] // only asymmetric keys
+	g := newTestGuard(t, set, 0)
+	tests := []struct {
+		name string
+		hdr  header
+		sign signer
+	}{
+		{
+			// a public RSA key must never be used as an HMAC secret
+			name: "HS256 signed with RSA public key",
+			hdr:  header{Alg: AlgHS256, Kid: "rs"},
+			sign: hs256Signer(keys.rsa.N.Bytes()),
+		},
+		{
+			name: "HS256 signed with Ed25519 public key",
+			hdr:  header{Alg: AlgHS256, Kid: "ed"},
+			sign: hs256Signer(keys.ed.Public().(ed25519.PublicKey)),
+		},
+		{
+			name: "alg none",
+			hdr:  header{Alg: "none"},
+			sign: func([]byte) []byte { return nil },
+		},
+		{
+			name: "EdDSA token with RSA kid",
+			hdr:  header{Alg: AlgEdDSA, Kid: "rs"},
+			sign: edDSASigner(keys.ed),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := makeToken(t, tt.hdr, validClaims(), tt.sign)
+			if _, err := g.validate(bearerRequest(token)); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("expected ErrUnknownKey, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTokenWithoutKidTriesAllKeys(t *testing.T) {
+	otherSecret := []byte("fedcba9876543210fedcba9876543210")
+	g := newTestGuard(t, jwks{Keys: []jwk{
+		{Kty: "oct", Kid: "old", K: b64(hmacSecret)},
+		{Kty: "oct", Kid: "new", K: b64(otherSecret)},
+	}}, 0)
+	for _, secret := range [][]byte{hmacSecret, otherSecret} {
+		token := makeToken(t, header{Alg: AlgHS256}, validClaims(), hs256Signer(secret))
+		if _, err := g.validate(bearerRequest(token)); err != nil {
+			t.Errorf("expected a valid token, got %v", err)
+		}
+	}
+	token := makeToken(t, header{Alg: AlgHS256}, validClaims(), hs256Signer([]byte("unknown")))
+	if _, err := g.validate(bearerRequest(token)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestTimeClaimsWithLeeway(t *testing.T) {
+	g := newTestGuard(t, newTestKeys(t).jwks(), 30)
+	now := time.Now()
+	tests := []struct {
+		name   string
+		exp    time.Time
+		nbf    time.Time
+		expErr error
+	}{
+		{name: "valid", exp: now.Add(time.Minute)},
+		{name: "expired within leeway", exp: now.Add(-10 * time.Second)},
+		{name: "expired beyond leeway", exp: now.Add(-time.Minute), expErr: ErrTokenExpired},
+		{name: "nbf within leeway", exp: now.Add(time.Hour), nbf: now.Add(10 * time.Second)},
+		{name: "nbf beyond leeway", exp: now.Add(time.Hour), nbf: now.Add(time.Minute), expErr: ErrTokenNotYetValid},
+		{name: "missing exp", expErr: ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			delete(claims, "exp")
+			if !tt.exp.IsZero() {
+				claims["exp"] = tt.exp.Unix()
+			}
+			if !tt.nbf.IsZero() {
+				claims["nbf"] = tt.nbf.Unix()
+			}
+			token := makeToken(t, header{Alg: AlgHS256, Kid: "hs"}, claims, hs256Signer(hmacSecret))
+			_, err := g.validate(bearerRequest(token))
+			if tt.expErr == nil && err != nil {
+				t.Errorf("expected a valid token, got %v", err)
+			} else if !errors.Is(err, tt.expErr) {
+				t.Errorf("expected %v, got %v", tt.expErr, err)
+			}
+		})
+	}
+}
+
+func TestAudience(t *testing.T) {
+	g := newTestGuard(t, newTestKeys(t).jwks(), 0)
+	tests := []struct {
+		name  string
+		aud   any
+		valid bool
+	}{
+		{name: "single value", aud: testAudience, valid: true},
+		{name: "list", aud: []string{"other", testAudience}, valid: true},
+		{name: "different value", aud: "other", valid: false},
+		{name: "different list", aud: []string{"other", "another"}, valid: false},
+		{name: "missing", aud: nil, valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			delete(claims, "aud")
+			if tt.aud != nil {
+				claims["aud"] = tt.aud
+			}
+			token := makeToken(t, header{Alg: AlgHS256, Kid: "hs"}, claims, hs256Signer(hmacSecret))
+			_, err := g.validate(bearerRequest(token))
+			if tt.valid && err != nil {
+				t.Errorf("expected a valid token, got %v", err)
+			} else if !tt.valid && !errors.Is(err, ErrInvalidAudience) {
+				t.Errorf("expected ErrInvalidAudience, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUserIDClaim(t *testing.T) {
+	g := newTestGuard(t, newTestKeys(t).jwks(), 0)
+	tests := []struct {
+		name  string
+		sub   any
+		valid bool
+	}{
+		{name: "numeric string", sub: "42", valid: true},
+		{name: "number", sub: 42, valid: true},
+		{name: "negative string", sub: "-1", valid: false},
+		{name: "negative number", sub: -1, valid: false},
+		{name: "fractional number", sub: 42.5, valid: false},
+		{name: "non-numeric string", sub: "john", valid: false},
+		{name: "boolean", sub: true, valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			claims["sub"] = tt.sub
+			token := makeToken(t, header{Alg: AlgHS256, Kid: "hs"}, claims, hs256Signer(hmacSecret))
+			userID, err := g.DetermineTrueUserID(bearerRequest(token))
+			if tt.valid && (err != nil || userID != 42) {
+				t.Errorf("expected user 42, got %s (%v)", userID, err)
+			} else if !tt.valid && (!errors.Is(err, ErrMalformedToken) || userID.IsValid()) {
+				t.Errorf("expected ErrMalformedToken and an invalid user, got %s (%v)", userID, err)
+			}
+		})
+	}
+}
+
+func TestWWWAuthenticate(t *testing.T) {
+	g := newTestGuard(t, newTestKeys(t).jwks(), 0)
+	eval := g.EvaluateRequest(guardtest.NewRequest("/api/query", "192.0.2.30"), nil)
+	if eval.ProposedResponse != http.StatusUnauthorized || eval.Reason != guard.ReasonUnauthenticated {
+		t.Fatalf("expected 401 unauthenticated, got %d (%s)", eval.ProposedResponse, eval.Reason)
+	}
+	if v := eval.ResponseHeaders.Get("WWW-Authenticate"); v != `Bearer realm="apiguard"` {
+		t.Errorf("unexpected header for a missing token: %s", v)
+	}
+
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	expired := makeToken(t, header{Alg: AlgHS256, Kid: "hs"}, claims, hs256Signer(hmacSecret))
+	forged := makeToken(t, header{Alg: AlgHS256, Kid: "hs"}, validClaims(), hs256Signer([]byte("forged")))
+	tests := []struct {
+		name     string
+		token    string
+		expected string
+	}{
+		{
+			name:     "expired token",
+			token:    expired,
+			expected: `Bearer realm="apiguard", error="invalid_token", error_description="the access token expired"`,
+		},
+		{
+			name:     "invalid signature",
+			token:    forged,
+			expected: `Bearer realm="apiguard", error="invalid_token", error_description="the access token is invalid"`,
+		},
+		{
+			name:     "malformed token",
+			token:    "foo.bar",
+			expected: `Bearer realm="apiguard", error="invalid_token", error_description="the access token is invalid"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eval := g.EvaluateRequest(bearerRequest(tt.token), nil)
+			if eval.ProposedResponse != http.StatusUnauthorized {
+				t.Fatalf("expected status 401, got %d", eval.ProposedResponse)
+			}
+			v := eval.ResponseHeaders.Get("WWW-Authenticate")
+			if v != tt.expected {
+				t.Errorf("unexpected header %s", v)
+			}
+		})
+	}
+}
+
+func TestConformance(t *testing.T) {
+	g := newTestGuard(t, newTestKeys(t).jwks(), 0)
+	token := makeToken(t, header{Alg: AlgHS256, Kid: "hs"}, validClaims(), hs256Signer(hmacSecret))
+	fixtures := append(
+		guardtest.DefaultFixtures(),
+		guardtest.Fixture{
+			Name: "client with valid bearer token",
+			NewRequest: func() *http.Request {
+				return bearerRequest(token)
+			},
+		},
+	)
+	guardtest.Run(t, guardtest.Suite{
+		Guard:          g,
+		AnonymousUsers: common.AnonymousUsers{0, 1},
+		Fixtures:       fixtures,
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenNotYetValid = errors.New("token not yet valid")
+	ErrInvalidAudience  = errors.New("invalid token audience")
+	ErrInvalidIssuer    = errors.New("invalid token issuer")
+)
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// audience handles both variants of the "aud" claim (string and list)
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return err
+	}
+	*a = multi
+	return nil
+}
+
+// Claims contains registered claims validated by the guard
+// along with all the raw claims.
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Raw       map[string]any
+}
+
+func numericDate(v float64) time.Time {
+	return time.Unix(0, int64(v*float64(time.Second)))
+}
+
+// verifySignature verifies the signature of signingInput with the key
+func (vk *verificationKey) verifySignature(signingInput, sig []byte) bool {
+	switch vk.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, vk.hmacKey)
+		mac.Write(signingInput)
+		return hmac.Equal(mac.Sum(nil), sig)
+	case AlgRS256:
+		h := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(vk.rsaKey, crypto.SHA256, h[:], sig) == nil
+	case AlgEdDSA:
+		return ed25519.Verify(vk.edKey, signingInput, sig)
+	}
+	return false
+}
+
+// parseAndVerify parses the token, verifies its signature using one of the keys
+// and validates time-related claims, audience and issuer.
+func parseAndVerify(
+	token string,
+	keys []*verificationKey,
+	audience, issuer string,
+	leeway time.Duration,
+	now time.Time,
+) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+	rawHeader, err := decodeB64(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+	var hdr header
+	if err := json.Unmarshal(rawHeader, &hdr); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+	sig, err := decodeB64(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+	// A token without "kid" is verified against all the keys
+	// with a matching algorithm (e.g. during key rotation).
+	var candidates int
+	var verified bool
+	signingInput := []byte(parts[0] + "." + parts[1])
+	for _, k := range keys {
+		// the algorithm must always match the key type to prevent
+		// algorithm confusion attacks
+		if k.alg != hdr.Alg || (hdr.Kid != "" && k.kid != hdr.Kid) {
+			continue
+		}
+		candidates++
+		if k.verifySignature(signingInput, sig) {
+			verified = true
+			break
+		}
+	}
+	if candidates == 0 {
+		return nil, ErrUnknownKey
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+
+	rawPayload, err := decodeB64(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+	var claims Claims
+	if err := json.Unmarshal(rawPayload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+	if err := json.Unmarshal(rawPayload, &claims.Raw); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+	if claims.ExpiresAt == nil || !now.Before(numericDate(*claims.ExpiresAt).Add(leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if claims.NotBefore != nil && now.Add(leeway).Before(numericDate(*claims.NotBefore)) {
+		return nil, ErrTokenNotYetValid
+	}
+	if audience != "" && !slices.Contains(claims.Audience, audience) {
+		return nil, ErrInvalidAudience
+	}
+	if issuer != "" && claims.Issuer != issuer {
+		return nil, ErrInvalidIssuer
+	}
+	return &claims, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guard
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// GinEvaluationKey is a key under which the ReqEvaluation
+	// is stored in gin.Context by the gin middleware
+	GinEvaluationKey = "guardEvaluation"
+)
+
+type evaluationCtxKey struct{}
+
+// EvaluationFromContext returns a ReqEvaluation stored in the context
+// by a guard middleware
+func EvaluationFromContext(ctx context.Context) (ReqEvaluation, bool) {
+	eval, ok := ctx.Value(evaluationCtxKey{}).(ReqEvaluation)
+	return eval, ok
+}
+
+// MiddlewareOptions configures guard middlewares
+type MiddlewareOptions struct {
+
+	// ReadTimeoutSecs is passed to RestrictResponseTimeCtx
+	ReadTimeoutSecs int
+
+	// FallbackCookie is passed to ServiceGuard.EvaluateRequest
+	FallbackCookie *http.Cookie
+
+	// Ctx is a global application context used to abort
+	// response delays on shutdown. If nil, context.Background() is used.
+	Ctx context.Context
+
+	// OnDecision is an optional callback called after each evaluation
+	// (e.g. to log the decision via globctx.BackendLogger.LogGuardDecision)
+	OnDecision func(req *http.Request, eval ReqEvaluation)
+}
+
+// guardRequest evaluates the request and applies a response delay.
+// In case the request should not pass, an error response is written
+// and false is returned. Otherwise, the function returns a request
+// with the evaluation stored in its context.
+// In any case, the returned evaluation must be released once the request
+// is handled.
+func guardRequest(
+	g ServiceGuard,
+	opts MiddlewareOptions,
+	w http.ResponseWriter,
+	req *http.Request,
+) (*http.Request, ReqEvaluation, bool) {
+	eval := g.EvaluateRequest(req, opts.FallbackCookie)
+	if opts.OnDecision != nil {
+		opts.OnDecision(req, eval)
+	}
+	if eval.Error != nil || eval.ProposedResponse >= http.StatusBadRequest {
+		status := eval.ProposedResponse
+		if status < http.StatusBadRequest {
+			status = http.StatusInternalServerError
+		}
+		if eval.Error != nil {
+			log.Error().
+				Err(eval.Error).
+				Str("decidedBy", eval.DecidedBy).
+				Str("reason", string(eval.Reason)).
+				Msg("guard failed to evaluate request")
+		}
+		// internal errors are only logged so we do not leak any details
+		msg := eval.Reason.Message()
+		if msg == "" {
+			msg = http.StatusText(status)
+		}
+		eval.WriteHeaders(w)
+		uniresp.WriteJSONErrorResponse(w, uniresp.NewActionError(msg), status)
+		return req, eval, false
+	}
+	ctx := opts.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	clientID := common.ClientID{IP: ClientIPString(req), ID: eval.ClientID}
+	if err := RestrictResponseTimeCtx(ctx, w, req, opts.ReadTimeoutSecs, g, clientID); err != nil {
+		return req, eval, false
+	}
+	// headers may be provided also for passing requests (e.g. a new session cookie)
+	eval.WriteHeaders(w)
+	return req.WithContext(context.WithValue(req.Context(), evaluationCtxKey{}, eval)), eval, true
+}
+
+// NewHTTPMiddleware creates a net/http middleware which evaluates
+// requests using the guard, applies response delays and writes
+// JSON error responses for rejected requests. The ReqEvaluation
+// is available to downstream handlers via EvaluationFromContext.
+func NewHTTPMiddleware(g ServiceGuard, opts MiddlewareOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req, eval, ok := guardRequest(g, opts, w, req)
+			defer eval.ReleaseResources()
+			if !ok {
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// NewGinMiddleware creates a gin middleware with the same behavior
+// as NewHTTPMiddleware. In addition to the request context, the ReqEvaluation
+// is also stored in gin.Context under GinEvaluationKey.
+func NewGinMiddleware(g ServiceGuard, opts MiddlewareOptions) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req, eval, ok := guardRequest(g, opts, ctx.Writer, ctx.Request)
+		defer eval.ReleaseResources()
+		if !ok {
+			ctx.Abort()
+			return
+		}
+		ctx.Request = req
+		ctx.Set(GinEvaluationKey, eval)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("usage quota exceeded")
+)
+
+// Guard enforces quotas of user classes. Each allowed request is counted
+// to the user's usage once it is handled (i.e. when ReqEvaluation.Release
+// is called) so requests which are not served do not consume the quota.
+// Anonymous users (and requests without a valid user ID) are not subject
+// to quotas. As Release is called also for requests rejected by guards
+// evaluated later in a guard.Chain, the quota guard should be the last one.
+//
+// Please note that the check and the accounting are not atomic so under
+// heavy concurrent load, a user can slightly exceed the quota.
+type Guard struct {
+	service        string
+	tracker        *Tracker
+	anonymousUsers common.AnonymousUsers
+	resolveUserID  guard.UserIDResolver
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	ans := guard.ReqEvaluation{
+		ClientID:         common.InvalidUserID,
+		HumanID:          common.InvalidUserID,
+		ProposedResponse: http.StatusOK,
+	}
+	userID, err := g.DetermineTrueUserID(req)
+	if err != nil {
+		ans.ProposedResponse = http.StatusInternalServerError
+		ans.Reason = guard.ReasonInternalError
+		ans.Error = err
+		return ans
+	}
+	ans.ClientID = userID
+	ans.HumanID = userID
+	if !userID.IsValid() || g.anonymousUsers.IsAnonymous(userID) {
+		return ans
+	}
+	now := time.Now()
+	usage, err := g.tracker.CurrentUsage(req, userID, g.service, now)
+	if err != nil {
+		ans.ProposedResponse = http.StatusInternalServerError
+		ans.Reason = guard.ReasonInternalError
+		ans.Error = err
+		return ans
+	}
+	var resetAt time.Time
+	if usage.Daily.Exceeded() {
+		resetAt = usage.Daily.WindowEnd
+	}
+	if usage.Monthly.Exceeded() {
+		resetAt = usage.Monthly.WindowEnd
+	}
+	if !resetAt.IsZero() {
+		ans.ProposedResponse = http.StatusTooManyRequests
+		ans.Reason = guard.ReasonQuotaExceeded
+		ans.RetryAfter = resetAt.Sub(now)
+		ans.Error = ErrQuotaExceeded
+		return ans
+	}
+	var once sync.Once
+	ans.Release = func() {
+		once.Do(func() {
+			g.recordRequest(req, userID)
+		})
+	}
+	return ans
+}
+
+// recordRequest counts a handled request to the user's usage
+func (g *Guard) recordRequest(req *http.Request, userID common.UserID) {
+	if _, err := g.tracker.Record(req, userID, g.service, Usage{Requests: 1}, time.Now()); err != nil {
+		log.Error().
+			Err(err).
+			Str("service", g.service).
+			Int("userId", int(userID)).
+			Msg("failed to record quota usage")
+	}
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	return g.anonymousUsers.IsAnonymous(userID)
+}
+
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	if g.resolveUserID == nil {
+		return common.InvalidUserID, nil
+	}
+	return g.resolveUserID(req)
+}
+
+// NewGuard creates a new quota enforcing guard for the service
+func NewGuard(
+	service string,
+	tracker *Tracker,
+	anonymousUsers common.AnonymousUsers,
+	resolveUserID guard.UserIDResolver,
+) *Guard {
+	return &Guard{
+		service:        service,
+		tracker:        tracker,
+		anonymousUsers: anonymousUsers,
+		resolveUserID:  resolveUserID,
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+	"github.com/czcorpus/apiguard-common/guard/userclass"
+)
+
+func TestConformance(t *testing.T) {
+	anonymousUsers := common.AnonymousUsers{0, 1}
+	tracker := NewTracker(nil, nil, nil, nil)
+	guardtest.Run(t, guardtest.Suite{
+		Guard:          NewGuard("kontext", tracker, anonymousUsers, guardtest.ResolveUserID),
+		AnonymousUsers: anonymousUsers,
+	})
+}
+
+func newTestTracker(t *testing.T, dailyQuota int64) *Tracker {
+	t.Helper()
+	conf := &userclass.Conf{
+		Classes: []*userclass.Class{
+			{Name: "default", Quota: userclass.Quota{Daily: dailyQuota}},
+		},
+		DefaultClass: "default",
+	}
+	if err := conf.ValidateAndDefaults("userClasses"); err != nil {
+		t.Fatal(err)
+	}
+	return NewTracker(nil, userclass.NewClassifier(conf, nil), time.UTC, nil)
+}
+
+func authenticatedRequest() *http.Request {
+	req := guardtest.NewRequest("/api/query", "192.0.2.10")
+	req.Header.Set(guardtest.UserIDHeader, "key")
+	return req
+}
+
+func TestUsageCountedOnRelease(t *testing.T) {
+	tracker := newTestTracker(t, 10)
+	g := NewGuard("kontext", tracker, nil, guardtest.ResolveUserID)
+	req := authenticatedRequest()
+	eval := g.EvaluateRequest(req, nil)
+	if eval.ProposedResponse != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", eval.ProposedResponse)
+	}
+	usage, err := tracker.CurrentUsage(req, guardtest.AuthenticatedUserID, "kontext", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Daily.Usage.Requests != 0 {
+		t.Errorf("expected no usage before release, got %d", usage.Daily.Usage.Requests)
+	}
+	eval.ReleaseResources()
+	eval.ReleaseResources()
+	usage, err = tracker.CurrentUsage(req, guardtest.AuthenticatedUserID, "kontext", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Daily.Usage.Requests != 1 {
+		t.Errorf("expected a single counted request, got %d", usage.Daily.Usage.Requests)
+	}
+}
+
+func TestNewUsageHandlerRequiresResolver(t *testing.T) {
+	tracker := newTestTracker(t, 10)
+	if _, err := NewUsageHandler(tracker, nil, []string{"kontext"}); err == nil {
+		t.Error("expected an error for a missing user ID resolver")
+	}
+	if _, err := NewUsageHandler(tracker, guardtest.ResolveUserID, []string{"kontext"}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	tracker := newTestTracker(t, 3)
+	g := NewGuard("kontext", tracker, common.AnonymousUsers{0, 1}, guardtest.ResolveUserID)
+	for i := 0; i < 3; i++ {
+		eval := g.EvaluateRequest(authenticatedRequest(), nil)
+		if eval.ProposedResponse != http.StatusOK {
+			t.Fatalf("request %d within the quota rejected with status %d", i, eval.ProposedResponse)
+		}
+		eval.ReleaseResources()
+	}
+	eval := g.EvaluateRequest(authenticatedRequest(), nil)
+	if eval.ProposedResponse != http.StatusTooManyRequests || eval.Reason != guard.ReasonQuotaExceeded {
+		t.Fatalf("expected 429 quota exceeded, got %d (%s)", eval.ProposedResponse, eval.Reason)
+	}
+	if eval.RetryAfter <= 0 || eval.RetryAfter > 24*time.Hour {
+		t.Errorf("expected RetryAfter until the end of the day, got %v", eval.RetryAfter)
+	}
+
+	// anonymous users are not subject to quotas
+	for i := 0; i < 5; i++ {
+		eval := g.EvaluateRequest(guardtest.NewRequest("/api/query", "192.0.2.10"), nil)
+		if eval.ProposedResponse != http.StatusOK {
+			t.Fatalf("anonymous request rejected with status %d", eval.ProposedResponse)
+		}
+		eval.ReleaseResources()
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+)
+
+// NewUsageHandler creates an HTTP handler providing current quota usage
+// of the requesting user for the listed services. The optional URL
+// argument `service` narrows the response to a single service.
+// Both tracker and resolveUserID are required.
+func NewUsageHandler(
+	tracker *Tracker,
+	resolveUserID guard.UserIDResolver,
+	services []string,
+) (http.HandlerFunc, error) {
+	if tracker == nil {
+		return nil, fmt.Errorf("failed to create quota usage handler: missing tracker")
+	}
+	if resolveUserID == nil {
+		return nil, fmt.Errorf("failed to create quota usage handler: missing user ID resolver")
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		userID, err := resolveUserID(req)
+		if err != nil {
+			uniresp.WriteJSONErrorResponse(
+				w, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
+			return
+		}
+		if !userID.IsValid() {
+			uniresp.WriteJSONErrorResponse(
+				w, uniresp.NewActionError("unauthenticated user"), http.StatusUnauthorized)
+			return
+		}
+		srvs := services
+		if srv := req.URL.Query().Get("service"); srv != "" {
+			if !slices.Contains(services, srv) {
+				uniresp.WriteJSONErrorResponse(
+					w, uniresp.NewActionError("unknown service %s", srv), http.StatusNotFound)
+				return
+			}
+			srvs = []string{srv}
+		}
+		now := time.Now()
+		ans := make([]UserUsage, 0, len(srvs))
+		for _, srv := range srvs {
+			usage, err := tracker.CurrentUsage(req, userID, srv, now)
+			if err != nil {
+				uniresp.WriteJSONErrorResponse(
+					w, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
+				return
+			}
+			ans = append(ans, usage)
+		}
+		uniresp.WriteJSONResponse(w, ans)
+	}, nil
+}
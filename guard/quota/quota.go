@@ -0,0 +1,290 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package quota provides accounting of daily and monthly
+// service usage quotas defined by user classes.
+package quota
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/globctx"
+	"github.com/czcorpus/apiguard-common/guard/userclass"
+	"github.com/czcorpus/apiguard-common/reporting"
+	"github.com/rs/zerolog/log"
+)
+
+// Conf configures quota accounting
+type Conf struct {
+
+	// DBTable is a CNC DB table for usage data (see SQLStore).
+	// In case it is empty, usage is kept in memory only.
+	DBTable string `json:"dbTable"`
+
+	// CountProcTime enables accounting of backend processing time
+	// (see Tracker.ObserveBackendRequest)
+	CountProcTime bool `json:"countProcTime"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if conf.DBTable == "" {
+		log.Warn().Msgf("%s: dbTable not set, quota usage will be kept in memory only", context)
+	}
+	return nil
+}
+
+// PeriodUsage describes usage within a single calendar window
+type PeriodUsage struct {
+	Period      Period    `json:"period"`
+	WindowStart time.Time `json:"windowStart"`
+	WindowEnd   time.Time `json:"windowEnd"`
+	Usage       Usage     `json:"usage"`
+
+	// Limit is a maximum number of requests (zero means "no limit")
+	Limit int64 `json:"limit"`
+}
+
+// Exceeded tests whether the number of requests has reached the limit
+func (pu PeriodUsage) Exceeded() bool {
+	return pu.Limit > 0 && pu.Usage.Requests >= pu.Limit
+}
+
+// UserUsage describes both daily and monthly usage of a service by a user
+type UserUsage struct {
+	UserID  common.UserID `json:"userId"`
+	Service string        `json:"service"`
+	Class   string        `json:"class"`
+	Daily   PeriodUsage   `json:"daily"`
+	Monthly PeriodUsage   `json:"monthly"`
+}
+
+// -----
+
+// Tracker records service usage of users to a Store and reports it
+// via a reporting writer. Calendar windows are determined in
+// the Tracker's location.
+type Tracker struct {
+	store           Store
+	classifier      *userclass.Classifier
+	loc             *time.Location
+	reportingWriter reporting.ReportingWriter
+	countProcTime   bool
+}
+
+func (tr *Tracker) keys(userID common.UserID, service string, t time.Time) (UsageKey, UsageKey) {
+	t = t.In(tr.loc)
+	return UsageKey{
+			UserID:      userID,
+			Service:     service,
+			Period:      PeriodDay,
+			WindowStart: PeriodDay.WindowStart(t),
+		},
+		UsageKey{
+			UserID:      userID,
+			Service:     service,
+			Period:      PeriodMonth,
+			WindowStart: PeriodMonth.WindowStart(t),
+		}
+}
+
+// classFor returns a class of the user. In case the request is available,
+// a class assigned to the request's API key takes precedence
+// (see userclass.Classifier.ForRequest).
+func (tr *Tracker) classFor(req *http.Request, userID common.UserID) *userclass.Class {
+	if tr.classifier == nil {
+		return nil
+	}
+	if req != nil {
+		return tr.classifier.ForRequest(req, userID)
+	}
+	return tr.classifier.ForUser(userID)
+}
+
+func (tr *Tracker) mkUserUsage(
+	req *http.Request,
+	userID common.UserID,
+	service string,
+	t time.Time,
+	daily, monthly Usage,
+) UserUsage {
+	t = t.In(tr.loc)
+	ans := UserUsage{
+		UserID:  userID,
+		Service: service,
+		Daily: PeriodUsage{
+			Period:      PeriodDay,
+			WindowStart: PeriodDay.WindowStart(t),
+			WindowEnd:   PeriodDay.WindowEnd(t),
+			Usage:       daily,
+		},
+		Monthly: PeriodUsage{
+			Period:      PeriodMonth,
+			WindowStart: PeriodMonth.WindowStart(t),
+			WindowEnd:   PeriodMonth.WindowEnd(t),
+			Usage:       monthly,
+		},
+	}
+	if class := tr.classFor(req, userID); class != nil {
+		ans.Class = class.Name
+		ans.Daily.Limit = class.Quota.Daily
+		ans.Monthly.Limit = class.Quota.Monthly
+	}
+	return ans
+}
+
+// Record adds a request of the user made at time t to the user's usage
+// and returns the updated usage. The req is used to determine the user's
+// class and may be nil in which case the class is determined by the userID only.
+func (tr *Tracker) Record(
+	req *http.Request,
+	userID common.UserID,
+	service string,
+	delta Usage,
+	t time.Time,
+) (UserUsage, error) {
+	dayKey, monthKey := tr.keys(userID, service, t)
+	daily, err := tr.store.Add(dayKey, delta)
+	if err != nil {
+		return UserUsage{}, fmt.Errorf("failed to record quota usage: %w", err)
+	}
+	monthly, err := tr.store.Add(monthKey, delta)
+	if err != nil {
+		return UserUsage{}, fmt.Errorf("failed to record quota usage: %w", err)
+	}
+	ans := tr.mkUserUsage(req, userID, service, t, daily, monthly)
+	// processing time only updates are not worth reporting
+	if tr.reportingWriter != nil && delta.Requests > 0 {
+		tr.reportingWriter.Write(&reporting.QuotaUsageReport{
+			Created:         t,
+			UserID:          userID,
+			Service:         service,
+			Class:           ans.Class,
+			DailyRequests:   daily.Requests,
+			MonthlyRequests: monthly.Requests,
+			DailyProcTime:   daily.ProcTime.Seconds(),
+			MonthlyProcTime: monthly.ProcTime.Seconds(),
+			DailyLimit:      ans.Daily.Limit,
+			MonthlyLimit:    ans.Monthly.Limit,
+		})
+	}
+	return ans, nil
+}
+
+// CurrentUsage returns usage of the user in windows containing t.
+// The req is used the same way as in Record.
+func (tr *Tracker) CurrentUsage(
+	req *http.Request,
+	userID common.UserID,
+	service string,
+	t time.Time,
+) (UserUsage, error) {
+	dayKey, monthKey := tr.keys(userID, service, t)
+	daily, err := tr.store.Get(dayKey)
+	if err != nil {
+		return UserUsage{}, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+	monthly, err := tr.store.Get(monthKey)
+	if err != nil {
+		return UserUsage{}, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+	return tr.mkUserUsage(req, userID, service, t, daily, monthly), nil
+}
+
+// ObserveBackendRequest adds backend processing time to the user's usage.
+// The request itself is not counted as it is expected to be already
+// counted by the quota Guard. To use the method, register the Tracker
+// via globctx.BackendLogger.AddObserver and enable it by TrackerWithProcTime.
+func (tr *Tracker) ObserveBackendRequest(bReq *reporting.BackendRequest) {
+	if !tr.countProcTime || !bReq.UserID.IsValid() || bReq.IsCached {
+		return
+	}
+	_, err := tr.Record(
+		nil,
+		bReq.UserID,
+		bReq.Service,
+		Usage{ProcTime: time.Duration(bReq.ProcTime * float64(time.Second))},
+		bReq.Created,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("service", bReq.Service).Msg("failed to account processing time")
+	}
+}
+
+// TrackerWithProcTime enables accounting of backend processing time
+func TrackerWithProcTime() func(*Tracker) {
+	return func(tr *Tracker) {
+		tr.countProcTime = true
+	}
+}
+
+// NewTracker creates a new usage tracker. In case store is nil, a MemoryStore
+// is used, in case loc is nil, time.Local is used. Without a classifier, no limits
+// are known. The reportingWriter is optional.
+func NewTracker(
+	store Store,
+	classifier *userclass.Classifier,
+	loc *time.Location,
+	reportingWriter reporting.ReportingWriter,
+	opts ...func(*Tracker),
+) *Tracker {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	ans := &Tracker{
+		store:           store,
+		classifier:      classifier,
+		loc:             loc,
+		reportingWriter: reportingWriter,
+	}
+	for _, opt := range opts {
+		opt(ans)
+	}
+	return ans
+}
+
+// NewTrackerFromConf creates a Tracker using resources of the global context.
+// Calendar windows are determined in the context's timezone.
+func NewTrackerFromConf(
+	conf *Conf,
+	globalCtx *globctx.Context,
+	classifier *userclass.Classifier,
+) *Tracker {
+	var store Store
+	if conf.DBTable != "" {
+		store = NewSQLStore(globalCtx.CNCDB, conf.DBTable)
+	}
+	var opts []func(*Tracker)
+	if conf.CountProcTime {
+		opts = append(opts, TrackerWithProcTime())
+	}
+	return NewTracker(
+		store,
+		classifier,
+		globalCtx.TimezoneLocation,
+		globalCtx.ReportingWriter,
+		opts...,
+	)
+}
@@ -0,0 +1,217 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+)
+
+// Period is a calendar window quotas are defined for
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+
+	// memoryRetention specifies how long the MemoryStore keeps
+	// usage of past windows (it must be longer than the longest period)
+	memoryRetention = 62 * 24 * time.Hour
+)
+
+// WindowStart returns the beginning of the calendar window containing t.
+// The window is determined in t's location.
+func (p Period) WindowStart(t time.Time) time.Time {
+	switch p {
+	case PeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+// WindowEnd returns the end (exclusive) of the calendar window containing t
+func (p Period) WindowEnd(t time.Time) time.Time {
+	start := p.WindowStart(t)
+	switch p {
+	case PeriodMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// UsageKey identifies a usage counter
+type UsageKey struct {
+	UserID  common.UserID
+	Service string
+	Period  Period
+
+	// WindowStart is the beginning of the calendar window
+	// (see Period.WindowStart)
+	WindowStart time.Time
+}
+
+func (uk UsageKey) String() string {
+	return fmt.Sprintf(
+		"%s:%s:%s:%s", uk.UserID, uk.Service, uk.Period, uk.WindowStart.Format(time.RFC3339))
+}
+
+// Usage describes consumption of a service within a window
+type Usage struct {
+	Requests int64
+	ProcTime time.Duration
+}
+
+func (u Usage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Requests int64   `json:"requests"`
+		ProcTime float64 `json:"procTime"`
+	}{
+		Requests: u.Requests,
+		ProcTime: u.ProcTime.Seconds(),
+	})
+}
+
+// -----
+
+// Store persists quota usage
+type Store interface {
+
+	// Add increases usage of the key by delta and returns
+	// the updated usage
+	Add(key UsageKey, delta Usage) (Usage, error)
+
+	// Get returns the current usage of the key. In case there
+	// is no record, zero usage and no error is returned.
+	Get(key UsageKey) (Usage, error)
+}
+
+// -----
+
+// MemoryStore is an in-memory implementation of Store. Records
+// of old windows are removed automatically.
+type MemoryStore struct {
+	data      map[string]Usage
+	starts    map[string]time.Time
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+func (ms *MemoryStore) prune(now time.Time) {
+	for k, start := range ms.starts {
+		if now.Sub(start) > memoryRetention {
+			delete(ms.data, k)
+			delete(ms.starts, k)
+		}
+	}
+	ms.lastPrune = now
+}
+
+func (ms *MemoryStore) Add(key UsageKey, delta Usage) (Usage, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	now := time.Now()
+	if now.Sub(ms.lastPrune) > time.Hour {
+		ms.prune(now)
+	}
+	k := key.String()
+	curr := ms.data[k]
+	curr.Requests += delta.Requests
+	curr.ProcTime += delta.ProcTime
+	ms.data[k] = curr
+	ms.starts[k] = key.WindowStart
+	return curr, nil
+}
+
+func (ms *MemoryStore) Get(key UsageKey) (Usage, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.data[key.String()], nil
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		data:      make(map[string]Usage),
+		starts:    make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// -----
+
+// SQLStore is a Store using an SQL database (typically the CNC DB, i.e. MySQL/MariaDB).
+// The table is expected to contain columns:
+// user_id (int), service (varchar), period (varchar), window_start (datetime),
+// num_requests (bigint) and proc_time (double, in seconds) with a unique key
+// on (user_id, service, period, window_start).
+type SQLStore struct {
+	db        *sql.DB
+	tableName string
+}
+
+func (ss *SQLStore) Add(key UsageKey, delta Usage) (Usage, error) {
+	_, err := ss.db.Exec(
+		fmt.Sprintf(
+			"INSERT INTO %s (user_id, service, period, window_start, num_requests, proc_time) "+
+				"VALUES (?, ?, ?, ?, ?, ?) "+
+				"ON DUPLICATE KEY UPDATE num_requests = num_requests + VALUES(num_requests), "+
+				"proc_time = proc_time + VALUES(proc_time)",
+			ss.tableName,
+		),
+		int(key.UserID), key.Service, string(key.Period), key.WindowStart,
+		delta.Requests, delta.ProcTime.Seconds(),
+	)
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to add quota usage for %s: %w", key, err)
+	}
+	return ss.Get(key)
+}
+
+func (ss *SQLStore) Get(key UsageKey) (Usage, error) {
+	row := ss.db.QueryRow(
+		fmt.Sprintf(
+			"SELECT num_requests, proc_time FROM %s "+
+				"WHERE user_id = ? AND service = ? AND period = ? AND window_start = ?",
+			ss.tableName,
+		),
+		int(key.UserID), key.Service, string(key.Period), key.WindowStart,
+	)
+	var numReq int64
+	var procTime float64
+	if err := row.Scan(&numReq, &procTime); errors.Is(err, sql.ErrNoRows) {
+		return Usage{}, nil
+
+	} else if err != nil {
+		return Usage{}, fmt.Errorf("failed to get quota usage for %s: %w", key, err)
+	}
+	return Usage{
+		Requests: numReq,
+		ProcTime: time.Duration(procTime * float64(time.Second)),
+	}, nil
+}
+
+func NewSQLStore(db *sql.DB, tableName string) *SQLStore {
+	return &SQLStore{db: db, tableName: tableName}
+}
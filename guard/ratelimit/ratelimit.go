@@ -0,0 +1,319 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit provides a token bucket based ServiceGuard
+package ratelimit
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/userclass"
+)
+
+const (
+	dfltSweepIntervalSecs = 60
+	dfltMaxBuckets        = 100000
+)
+
+// BucketConf defines a token bucket
+type BucketConf struct {
+
+	// RatePerSec specifies how many tokens are added per second
+	RatePerSec float64 `json:"ratePerSec"`
+
+	// Burst is the bucket capacity, i.e. how many requests
+	// can be performed at once
+	Burst int `json:"burst"`
+}
+
+func (bc BucketConf) Validate(context string) error {
+	if bc.RatePerSec <= 0 {
+		return fmt.Errorf("%s.ratePerSec must be a positive number", context)
+	}
+	if bc.Burst < 1 {
+		return fmt.Errorf("%s.burst must be at least 1", context)
+	}
+	return nil
+}
+
+// Conf configures the rate limiting guard
+type Conf struct {
+	Anonymous     BucketConf `json:"anonymous"`
+	Authenticated BucketConf `json:"authenticated"`
+
+	// SweepIntervalSecs specifies how often idle buckets are evicted
+	SweepIntervalSecs int `json:"sweepIntervalSecs"`
+
+	// MaxBuckets is a hard limit of tracked clients. Once reached,
+	// the least recently seen client is evicted to make room
+	// for a new one.
+	MaxBuckets int `json:"maxBuckets"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if err := conf.Anonymous.Validate(context + ".anonymous"); err != nil {
+		return err
+	}
+	if err := conf.Authenticated.Validate(context + ".authenticated"); err != nil {
+		return err
+	}
+	if conf.SweepIntervalSecs == 0 {
+		conf.SweepIntervalSecs = dfltSweepIntervalSecs
+	}
+	if conf.MaxBuckets == 0 {
+		conf.MaxBuckets = dfltMaxBuckets
+	}
+	if conf.MaxBuckets < 0 {
+		return fmt.Errorf("%s.maxBuckets cannot be negative", context)
+	}
+	return nil
+}
+
+// -----
+
+type bucket struct {
+	key      string
+	tokens   float64
+	lastSeen time.Time
+	conf     BucketConf
+}
+
+// refill updates the number of tokens based on elapsed time
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(
+		float64(b.conf.Burst),
+		b.tokens+now.Sub(b.lastSeen).Seconds()*b.conf.RatePerSec,
+	)
+	b.lastSeen = now
+}
+
+// isIdle returns true if the bucket is already full which means
+// it is equivalent to a new one and can be removed
+func (b *bucket) isIdle(now time.Time) bool {
+	return b.tokens+now.Sub(b.lastSeen).Seconds()*b.conf.RatePerSec >= float64(b.conf.Burst)
+}
+
+// take tries to take a single token. In case there is none,
+// the function returns duration after which a token will be available
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / b.conf.RatePerSec
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// -----
+
+// Guard is a token bucket based rate limiter. Buckets are keyed
+// by common.ClientID.GetKey(), anonymous and authenticated users
+// have separate limits (which can be further overridden by user classes,
+// see GuardWithClassifier). Buckets which are already refilled are
+// periodically evicted (at most once per Conf.SweepIntervalSecs).
+// Regardless of that, the number of buckets never exceeds Conf.MaxBuckets
+// as the least recently seen clients are evicted to make room for new ones.
+type Guard struct {
+	conf           *Conf
+	anonymousUsers common.AnonymousUsers
+	resolveUserID  guard.UserIDResolver
+	classifier     *userclass.Classifier
+	buckets        map[string]*list.Element
+
+	// recent contains buckets ordered by their last use
+	// (the most recent one at the front)
+	recent    *list.List
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func (g *Guard) sweep(now time.Time) {
+	for elm := g.recent.Front(); elm != nil; {
+		next := elm.Next()
+		if b := elm.Value.(*bucket); b.isIdle(now) {
+			g.recent.Remove(elm)
+			delete(g.buckets, b.key)
+		}
+		elm = next
+	}
+	g.lastSweep = now
+}
+
+// evictOldest removes the least recently seen buckets so there
+// is room for a new one
+func (g *Guard) evictOldest() {
+	for len(g.buckets) >= g.conf.MaxBuckets {
+		elm := g.recent.Back()
+		if elm == nil {
+			return
+		}
+		g.recent.Remove(elm)
+		delete(g.buckets, elm.Value.(*bucket).key)
+	}
+}
+
+func (g *Guard) isAnonymous(userID common.UserID) bool {
+	return !userID.IsValid() || g.anonymousUsers.IsAnonymous(userID)
+}
+
+// Allow takes a token for the client. In case the client has
+// exceeded its limit, false is returned along with time to wait
+// for a next token. User classes are resolved by the user ID only
+// as there is no request to read an API key from.
+func (g *Guard) Allow(clientID common.ClientID) (bool, time.Duration) {
+	return g.allow(clientID, g.bucketConf(nil, clientID.ID))
+}
+
+// bucketConf returns a bucket configuration for the request, taking
+// a possible user class into account. The req may be nil in which case
+// the class is determined by the userID only.
+func (g *Guard) bucketConf(req *http.Request, userID common.UserID) BucketConf {
+	if g.classifier != nil {
+		var c *userclass.Class
+		if req != nil {
+			c = g.classifier.ForRequest(req, userID)
+
+		} else {
+			c = g.classifier.ForUser(userID)
+		}
+		if c != nil && c.RateLimit != nil {
+			return BucketConf{RatePerSec: c.RateLimit.RatePerSec, Burst: c.RateLimit.Burst}
+		}
+	}
+	if g.isAnonymous(userID) {
+		return g.conf.Anonymous
+	}
+	return g.conf.Authenticated
+}
+
+func (g *Guard) allow(clientID common.ClientID, bConf BucketConf) (bool, time.Duration) {
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.lastSweep) >= time.Duration(g.conf.SweepIntervalSecs)*time.Second {
+		g.sweep(now)
+	}
+	key := clientID.GetKey()
+	var b *bucket
+	if elm, ok := g.buckets[key]; ok {
+		g.recent.MoveToFront(elm)
+		b = elm.Value.(*bucket)
+
+	} else {
+		g.evictOldest()
+		b = &bucket{key: key, tokens: float64(bConf.Burst), lastSeen: now, conf: bConf}
+		g.buckets[key] = g.recent.PushFront(b)
+	}
+	if b.conf != bConf {
+		// the client has changed its class
+		b.refill(now)
+		b.conf = bConf
+		b.tokens = min(b.tokens, float64(bConf.Burst))
+	}
+	return b.take(now)
+}
+
+// NumBuckets returns number of currently tracked clients
+func (g *Guard) NumBuckets() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.buckets)
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	userID, err := g.DetermineTrueUserID(req)
+	if err != nil {
+		return guard.ReqEvaluation{
+			ClientID:         common.InvalidUserID,
+			HumanID:          common.InvalidUserID,
+			ProposedResponse: http.StatusInternalServerError,
+			Reason:           guard.ReasonInternalError,
+			Error:            err,
+		}
+	}
+	clientID := common.ClientID{IP: guard.ClientIPString(req), ID: userID}
+	ans := guard.ReqEvaluation{
+		ClientID:         userID,
+		HumanID:          userID,
+		ProposedResponse: http.StatusOK,
+	}
+	if ok, wait := g.allow(clientID, g.bucketConf(req, userID)); !ok {
+		ans.ProposedResponse = http.StatusTooManyRequests
+		ans.Reason = guard.ReasonRateLimited
+		ans.RetryAfter = wait
+	}
+	return ans
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	return g.anonymousUsers.IsAnonymous(userID)
+}
+
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	if g.resolveUserID == nil {
+		return common.InvalidUserID, nil
+	}
+	return g.resolveUserID(req)
+}
+
+// GuardWithClassifier makes the guard use rate limits of user classes.
+// Users whose class has no rate limit use the guard's own configuration.
+func GuardWithClassifier(classifier *userclass.Classifier) func(*Guard) {
+	return func(g *Guard) {
+		g.classifier = classifier
+	}
+}
+
+// NewGuard creates a new rate limiting guard. The resolveUserID
+// may be nil in which case all the users are considered anonymous.
+func NewGuard(
+	conf *Conf,
+	anonymousUsers common.AnonymousUsers,
+	resolveUserID guard.UserIDResolver,
+	opts ...func(*Guard),
+) *Guard {
+	ans := &Guard{
+		conf:           conf,
+		anonymousUsers: anonymousUsers,
+		resolveUserID:  resolveUserID,
+		buckets:        make(map[string]*list.Element),
+		recent:         list.New(),
+		lastSweep:      time.Now(),
+	}
+	for _, opt := range opts {
+		opt(ans)
+	}
+	return ans
+}
@@ -0,0 +1,79 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+)
+
+func newTestGuard(t *testing.T, maxBuckets int) *Guard {
+	t.Helper()
+	conf := &Conf{
+		Anonymous:     BucketConf{RatePerSec: 1, Burst: 5},
+		Authenticated: BucketConf{RatePerSec: 10, Burst: 20},
+		MaxBuckets:    maxBuckets,
+	}
+	if err := conf.ValidateAndDefaults("ratelimit"); err != nil {
+		t.Fatal(err)
+	}
+	return NewGuard(conf, common.AnonymousUsers{0, 1}, guardtest.ResolveUserID)
+}
+
+func TestConformance(t *testing.T) {
+	guardtest.Run(t, guardtest.Suite{
+		Guard:          newTestGuard(t, 4),
+		AnonymousUsers: common.AnonymousUsers{0, 1},
+	})
+}
+
+func TestRejectsAfterBurst(t *testing.T) {
+	g := newTestGuard(t, 100)
+	for i := 0; i < 5; i++ {
+		eval := g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.10"), nil)
+		if eval.ProposedResponse != http.StatusOK {
+			t.Fatalf("request %d within the burst rejected with status %d", i, eval.ProposedResponse)
+		}
+	}
+	eval := g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.10"), nil)
+	if eval.ProposedResponse != http.StatusTooManyRequests || eval.Reason != guard.ReasonRateLimited {
+		t.Fatalf("expected 429 rate limited after the burst, got %d (%s)", eval.ProposedResponse, eval.Reason)
+	}
+	if eval.RetryAfter <= 0 || eval.RetryAfter > time.Second {
+		t.Errorf("expected RetryAfter within (0, 1s], got %v", eval.RetryAfter)
+	}
+
+	// other clients have their own buckets
+	eval = g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.11"), nil)
+	if eval.ProposedResponse != http.StatusOK {
+		t.Errorf("expected 200 for a different client, got %d", eval.ProposedResponse)
+	}
+	// authenticated users have a larger burst
+	for i := 0; i < 20; i++ {
+		req := guardtest.NewRequest("/", "192.0.2.10")
+		req.Header.Set(guardtest.UserIDHeader, "key")
+		if eval := g.EvaluateRequest(req, nil); eval.ProposedResponse != http.StatusOK {
+			t.Fatalf("authenticated request %d rejected with status %d", i, eval.ProposedResponse)
+		}
+	}
+}
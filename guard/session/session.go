@@ -0,0 +1,277 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package session provides a guard validating signed WaG session cookies
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/logging"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltMaxAgeSecs     = 24 * 3600
+	dfltIPv4PrefixBits = 24
+	dfltIPv6PrefixBits = 48
+	minSecretLength    = 32
+	sessionIDBytes     = 16
+	macBytes           = 16
+	bindingTagBytes    = 8
+	maxClockSkew       = time.Minute
+)
+
+var (
+	ErrMalformedSession = errors.New("malformed session cookie")
+	ErrInvalidSignature = errors.New("invalid session signature")
+	ErrSessionExpired   = errors.New("session expired")
+	ErrBindingMismatch  = errors.New("session bound to a different client")
+)
+
+// Conf configures the session guard
+type Conf struct {
+
+	// CookieName is a name of the session cookie (logging.WaGSessionName by default)
+	CookieName string `json:"cookieName"`
+
+	// Secret is used to sign session cookies. It must be at least 32 characters long.
+	Secret string `json:"secret"`
+
+	MaxAgeSecs int `json:"maxAgeSecs"`
+
+	// IPv4PrefixBits and IPv6PrefixBits specify client IP network prefixes
+	// a session is bound to. Using whole addresses is not recommended as
+	// some clients change their addresses within a network often.
+	IPv4PrefixBits int `json:"ipv4PrefixBits"`
+	IPv6PrefixBits int `json:"ipv6PrefixBits"`
+
+	// BindUserAgent specifies whether a session is bound also to the User-Agent
+	BindUserAgent bool `json:"bindUserAgent"`
+
+	CookiePath   string `json:"cookiePath"`
+	CookieSecure bool   `json:"cookieSecure"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	if len(conf.Secret) < minSecretLength {
+		return fmt.Errorf("%s.secret must be at least %d characters long", context, minSecretLength)
+	}
+	if conf.CookieName == "" {
+		conf.CookieName = logging.WaGSessionName
+	}
+	if conf.MaxAgeSecs == 0 {
+		conf.MaxAgeSecs = dfltMaxAgeSecs
+	}
+	if conf.MaxAgeSecs < 0 {
+		return fmt.Errorf("%s.maxAgeSecs cannot be negative", context)
+	}
+	if conf.IPv4PrefixBits == 0 {
+		conf.IPv4PrefixBits = dfltIPv4PrefixBits
+	}
+	if conf.IPv4PrefixBits < 0 || conf.IPv4PrefixBits > 32 {
+		return fmt.Errorf("%s.ipv4PrefixBits must be between 0 and 32", context)
+	}
+	if conf.IPv6PrefixBits == 0 {
+		conf.IPv6PrefixBits = dfltIPv6PrefixBits
+	}
+	if conf.IPv6PrefixBits < 0 || conf.IPv6PrefixBits > 128 {
+		return fmt.Errorf("%s.ipv6PrefixBits must be between 0 and 128", context)
+	}
+	if conf.CookiePath == "" {
+		conf.CookiePath = "/"
+	}
+	return nil
+}
+
+// -----
+
+// Guard validates HMAC-signed session cookies. The cookie value
+// has the form "<sessionID>.<issued>.<bindingTag>.<mac>" where the binding
+// tag is a keyed hash of the client's IP prefix (and optionally the User-Agent)
+// and the MAC covers all the preceding parts.
+// A cookie with an invalid MAC is considered forged and the request is
+// rejected. A cookie with a valid MAC but bound to a different network
+// (or browser) is not accepted either but, as it may be caused by a legitimate
+// network change, a new session is issued via ReqEvaluation.ResponseHeaders
+// (the same applies to missing and expired sessions).
+// Replaying a cookie is limited by MaxAgeSecs (checked against the signed
+// issue time, not just the cookie expiration) and by the binding.
+type Guard struct {
+	conf *Conf
+}
+
+// binding returns a value identifying the client's network
+// (and user agent) a session is bound to.
+func (g *Guard) binding(req *http.Request) string {
+	var ans strings.Builder
+	ans.WriteString(guard.ClientNetwork(req, g.conf.IPv4PrefixBits, g.conf.IPv6PrefixBits))
+	if g.conf.BindUserAgent {
+		ans.WriteString("|")
+		ans.WriteString(req.UserAgent())
+	}
+	return ans.String()
+}
+
+func (g *Guard) hash(value string, size int) string {
+	mac := hmac.New(sha256.New, []byte(g.conf.Secret))
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:size])
+}
+
+// bindingTag returns a keyed hash of the request binding. The secret
+// prevents clients from computing a tag matching a different network.
+func (g *Guard) bindingTag(req *http.Request) string {
+	return g.hash("binding:"+g.binding(req), bindingTagBytes)
+}
+
+func (g *Guard) sign(sessionID, issued, bindingTag string) string {
+	return g.hash(sessionID+"."+issued+"."+bindingTag, macBytes)
+}
+
+// NewSession creates a new session ID and a respective signed cookie value
+func (g *Guard) NewSession(req *http.Request, now time.Time) (string, string, error) {
+	rnd := make([]byte, sessionIDBytes)
+	if _, err := rand.Read(rnd); err != nil {
+		return "", "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	sessionID := base64.RawURLEncoding.EncodeToString(rnd)
+	issued := strconv.FormatInt(now.Unix(), 36)
+	tag := g.bindingTag(req)
+	return sessionID, sessionID + "." + issued + "." + tag + "." + g.sign(sessionID, issued, tag), nil
+}
+
+// SessionIDFromCookie returns a session ID contained in a cookie value
+// without validating the cookie. It is intended for components which
+// need to identify a session (e.g. bans) but do not validate it themselves.
+func SessionIDFromCookie(value string) string {
+	sessionID, _, _ := strings.Cut(value, ".")
+	return sessionID
+}
+
+// Validate validates a cookie value and returns the contained session ID.
+// The signature is verified first so ErrSessionExpired and ErrBindingMismatch
+// are returned only for cookies issued by the guard.
+func (g *Guard) Validate(req *http.Request, value string, now time.Time) (string, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 4 {
+		return "", ErrMalformedSession
+	}
+	expected := g.sign(parts[0], parts[1], parts[2])
+	if !hmac.Equal([]byte(expected), []byte(parts[3])) {
+		return "", ErrInvalidSignature
+	}
+	issued, err := strconv.ParseInt(parts[1], 36, 64)
+	if err != nil {
+		return "", ErrMalformedSession
+	}
+	age := now.Sub(time.Unix(issued, 0))
+	if age > time.Duration(g.conf.MaxAgeSecs)*time.Second || age < -maxClockSkew {
+		return parts[0], ErrSessionExpired
+	}
+	if !hmac.Equal([]byte(g.bindingTag(req)), []byte(parts[2])) {
+		return parts[0], ErrBindingMismatch
+	}
+	return parts[0], nil
+}
+
+func (g *Guard) mkCookie(value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     g.conf.CookieName,
+		Value:    value,
+		Path:     g.conf.CookiePath,
+		MaxAge:   g.conf.MaxAgeSecs,
+		Secure:   g.conf.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	return 0, nil
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	return nil
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	ans := guard.ReqEvaluation{
+		ClientID:         common.InvalidUserID,
+		HumanID:          common.InvalidUserID,
+		ProposedResponse: http.StatusOK,
+	}
+	now := time.Now()
+	cookie, err := req.Cookie(g.conf.CookieName)
+	if err == nil {
+		sessionID, err := g.Validate(req, cookie.Value, now)
+		if err == nil {
+			ans.SessionID = sessionID
+			return ans
+		}
+		switch {
+		case errors.Is(err, ErrSessionExpired):
+		case errors.Is(err, ErrBindingMismatch):
+			log.Debug().
+				Str("clientIP", guard.ClientIPString(req)).
+				Msg("session cookie bound to a different client, issuing a new one")
+		default:
+			// malformed or forged cookie
+			ans.ProposedResponse = http.StatusForbidden
+			ans.Reason = guard.ReasonInvalidSession
+			ans.Error = err
+			return ans
+		}
+	}
+	// missing, expired or mismatching session => issue a new one
+	sessionID, value, err := g.NewSession(req, now)
+	if err != nil {
+		ans.ProposedResponse = http.StatusInternalServerError
+		ans.Reason = guard.ReasonInternalError
+		ans.Error = err
+		return ans
+	}
+	ans.SessionID = sessionID
+	ans.ResponseHeaders = http.Header{"Set-Cookie": []string{g.mkCookie(value).String()}}
+	return ans
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	return false
+}
+
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	return common.InvalidUserID, nil
+}
+
+func NewGuard(conf *Conf) *Guard {
+	return &Guard{conf: conf}
+}
@@ -0,0 +1,134 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+)
+
+func newTestGuard(t *testing.T) *Guard {
+	t.Helper()
+	conf := &Conf{Secret: "0123456789abcdef0123456789abcdef", MaxAgeSecs: 3600}
+	if err := conf.ValidateAndDefaults("session"); err != nil {
+		t.Fatal(err)
+	}
+	return NewGuard(conf)
+}
+
+func requestWithCookie(g *Guard, clientIP, value string) *http.Request {
+	req := guardtest.NewRequest("/api/query", clientIP)
+	req.AddCookie(&http.Cookie{Name: g.conf.CookieName, Value: value})
+	return req
+}
+
+func newSessionCookie(t *testing.T, g *Guard, clientIP string, issued time.Time) (string, string) {
+	t.Helper()
+	sessionID, value, err := g.NewSession(guardtest.NewRequest("/", clientIP), issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sessionID, value
+}
+
+func TestConformance(t *testing.T) {
+	conf := &Conf{Secret: "0123456789abcdef0123456789abcdef"}
+	if err := conf.ValidateAndDefaults("session"); err != nil {
+		t.Fatal(err)
+	}
+	guardtest.Run(t, guardtest.Suite{Guard: NewGuard(conf)})
+}
+
+func TestValidSession(t *testing.T) {
+	g := newTestGuard(t)
+	sessionID, value := newSessionCookie(t, g, "192.0.2.10", time.Now())
+	// the same /24 network
+	eval := g.EvaluateRequest(requestWithCookie(g, "192.0.2.99", value), nil)
+	if eval.ProposedResponse != http.StatusOK || eval.SessionID != sessionID {
+		t.Errorf("expected 200 with session %s, got %d with %s", sessionID, eval.ProposedResponse, eval.SessionID)
+	}
+	if eval.ResponseHeaders.Get("Set-Cookie") != "" {
+		t.Error("valid session should not be reissued")
+	}
+}
+
+func TestForgedSessionRejected(t *testing.T) {
+	g := newTestGuard(t)
+	_, value := newSessionCookie(t, g, "192.0.2.10", time.Now())
+	parts := strings.Split(value, ".")
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "tampered session ID", value: strings.Join([]string{"AAAAAAAAAAAAAAAAAAAAAA", parts[1], parts[2], parts[3]}, ".")},
+		{name: "tampered issue time", value: strings.Join([]string{parts[0], "zzzzzz", parts[2], parts[3]}, ".")},
+		{name: "tampered binding", value: strings.Join([]string{parts[0], parts[1], "AAAAAAAAAAA", parts[3]}, ".")},
+		{name: "malformed", value: "foo.bar.baz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eval := g.EvaluateRequest(requestWithCookie(g, "192.0.2.10", tt.value), nil)
+			if eval.ProposedResponse != http.StatusForbidden || eval.Reason != guard.ReasonInvalidSession {
+				t.Errorf("expected 403 invalid session, got %d (%s)", eval.ProposedResponse, eval.Reason)
+			}
+			if eval.ResponseHeaders.Get("Set-Cookie") != "" {
+				t.Error("forged session should not be reissued")
+			}
+		})
+	}
+}
+
+func TestSessionReissued(t *testing.T) {
+	g := newTestGuard(t)
+	now := time.Now()
+	tests := []struct {
+		name     string
+		clientIP string
+		issued   time.Time
+		expErr   error
+	}{
+		{name: "different network", clientIP: "198.51.100.10", issued: now, expErr: ErrBindingMismatch},
+		{name: "expired", clientIP: "192.0.2.10", issued: now.Add(-2 * time.Hour), expErr: ErrSessionExpired},
+		{name: "issued in the future", clientIP: "192.0.2.10", issued: now.Add(time.Hour), expErr: ErrSessionExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionID, value := newSessionCookie(t, g, "192.0.2.10", tt.issued)
+			req := requestWithCookie(g, tt.clientIP, value)
+			if _, err := g.Validate(req, value, now); !errors.Is(err, tt.expErr) {
+				t.Errorf("expected %v, got %v", tt.expErr, err)
+			}
+			eval := g.EvaluateRequest(req, nil)
+			if eval.ProposedResponse != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", eval.ProposedResponse)
+			}
+			if eval.SessionID == "" || eval.SessionID == sessionID {
+				t.Errorf("expected a new session, got %q", eval.SessionID)
+			}
+			if eval.ResponseHeaders.Get("Set-Cookie") == "" {
+				t.Error("expected a new session cookie")
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shadow provides a wrapper running a ServiceGuard
+// in a dry-run (shadow) mode.
+package shadow
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/czcorpus/apiguard-common/reporting"
+	"github.com/rs/zerolog/log"
+)
+
+// Guard runs a shadow guard along with an (optional) active one.
+// Only the active guard's decisions and delays are applied. The shadow
+// guard's evaluation and delay are just recorded (along with the active
+// guard's decision) as reporting.ShadowGuardReport so the two can be compared.
+// Without an active guard, all the requests are allowed with no delay.
+//
+// Please note that resources reserved by the shadow guard (see ReqEvaluation.Release)
+// are released immediately.
+type Guard struct {
+	service         string
+	shadowName      string
+	shadow          guard.ServiceGuard
+	active          guard.ServiceGuard
+	reportingWriter reporting.ReportingWriter
+}
+
+func (g *Guard) CalcDelay(req *http.Request, clientID common.ClientID) (time.Duration, error) {
+	if g.active == nil {
+		return 0, nil
+	}
+	return g.active.CalcDelay(req, clientID)
+}
+
+func (g *Guard) LogAppliedDelay(respDelay time.Duration, clientID common.ClientID) error {
+	if g.active == nil {
+		return nil
+	}
+	return g.active.LogAppliedDelay(respDelay, clientID)
+}
+
+func (g *Guard) evaluateShadow(req *http.Request, fallbackCookie *http.Cookie) (guard.ReqEvaluation, time.Duration) {
+	eval := g.shadow.EvaluateRequest(req, fallbackCookie)
+	eval.ReleaseResources()
+	if eval.ForbidsAccess() || eval.Error != nil {
+		return eval, 0
+	}
+	clientID := common.ClientID{IP: guard.ClientIPString(req), ID: eval.ClientID}
+	delay, err := g.shadow.CalcDelay(req, clientID)
+	if err != nil {
+		log.Warn().Err(err).Str("guard", g.shadowName).Msg("shadow guard failed to calculate delay")
+		return eval, 0
+	}
+	// we log the delay as if it was applied so the shadow guard's
+	// state evolves as it would in the active mode
+	if err := g.shadow.LogAppliedDelay(delay, clientID); err != nil {
+		log.Warn().Err(err).Str("guard", g.shadowName).Msg("shadow guard failed to log delay")
+	}
+	return eval, delay
+}
+
+func (g *Guard) EvaluateRequest(req *http.Request, fallbackCookie *http.Cookie) guard.ReqEvaluation {
+	ans := guard.ReqEvaluation{
+		ClientID:         common.InvalidUserID,
+		HumanID:          common.InvalidUserID,
+		ProposedResponse: http.StatusOK,
+	}
+	if g.active != nil {
+		ans = g.active.EvaluateRequest(req, fallbackCookie)
+	}
+	shadowEval, shadowDelay := g.evaluateShadow(req, fallbackCookie)
+	report := &reporting.ShadowGuardReport{
+		Created:        time.Now(),
+		Service:        g.service,
+		ShadowGuard:    g.shadowName,
+		ClientIP:       guard.ClientIPString(req),
+		ClientID:       shadowEval.ClientID,
+		ShadowResponse: shadowEval.ProposedResponse,
+		ShadowDelay:    shadowDelay.Seconds(),
+		ActiveResponse: ans.ProposedResponse,
+	}
+	if shadowEval.Error != nil {
+		report.ShadowError = shadowEval.Error.Error()
+	}
+	if g.reportingWriter != nil {
+		g.reportingWriter.Write(report)
+	}
+	if !report.Agrees() {
+		log.Info().
+			Str("service", g.service).
+			Str("shadowGuard", g.shadowName).
+			Int("shadowResponse", report.ShadowResponse).
+			Int("activeResponse", report.ActiveResponse).
+			Msg("shadow guard decision differs from the active one")
+	}
+	return ans
+}
+
+func (g *Guard) TestUserIsAnonymous(userID common.UserID) bool {
+	if g.active == nil {
+		return g.shadow.TestUserIsAnonymous(userID)
+	}
+	return g.active.TestUserIsAnonymous(userID)
+}
+
+func (g *Guard) DetermineTrueUserID(req *http.Request) (common.UserID, error) {
+	if g.active == nil {
+		return g.shadow.DetermineTrueUserID(req)
+	}
+	return g.active.DetermineTrueUserID(req)
+}
+
+// NewGuard creates a shadow mode wrapper. The active guard may be nil
+// in which case all the requests are allowed.
+func NewGuard(
+	service string,
+	shadowName string,
+	shadow guard.ServiceGuard,
+	active guard.ServiceGuard,
+	reportingWriter reporting.ReportingWriter,
+) *Guard {
+	return &Guard{
+		service:         service,
+		shadowName:      shadowName,
+		shadow:          shadow,
+		active:          active,
+		reportingWriter: reportingWriter,
+	}
+}
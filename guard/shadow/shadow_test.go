@@ -0,0 +1,110 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shadow
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard/concurrency"
+	"github.com/czcorpus/apiguard-common/guard/guardtest"
+	"github.com/czcorpus/apiguard-common/guard/ratelimit"
+	"github.com/czcorpus/apiguard-common/reporting"
+)
+
+type reportCollector struct {
+	reports []*reporting.ShadowGuardReport
+	mu      sync.Mutex
+}
+
+func (rc *reportCollector) LogErrors() {}
+
+func (rc *reportCollector) Write(item reporting.Timescalable) {
+	if report, ok := item.(*reporting.ShadowGuardReport); ok {
+		rc.mu.Lock()
+		rc.reports = append(rc.reports, report)
+		rc.mu.Unlock()
+	}
+}
+
+func (rc *reportCollector) AddTableWriter(tableName string) {}
+
+func newRateLimitGuard(t *testing.T, burst int) *ratelimit.Guard {
+	t.Helper()
+	conf := &ratelimit.Conf{
+		Anonymous:     ratelimit.BucketConf{RatePerSec: 0.001, Burst: burst},
+		Authenticated: ratelimit.BucketConf{RatePerSec: 0.001, Burst: burst},
+	}
+	if err := conf.ValidateAndDefaults("ratelimit"); err != nil {
+		t.Fatal(err)
+	}
+	return ratelimit.NewGuard(conf, common.AnonymousUsers{0, 1}, guardtest.ResolveUserID)
+}
+
+func newConcurrencyGuard(t *testing.T) *concurrency.Guard {
+	t.Helper()
+	conf := &concurrency.Conf{MaxPerClient: 2, MaxPerService: 4, QueueSize: 2, QueueTimeoutMs: 10}
+	if err := conf.ValidateAndDefaults("concurrency"); err != nil {
+		t.Fatal(err)
+	}
+	return concurrency.NewGuard(conf, common.AnonymousUsers{0, 1}, guardtest.ResolveUserID)
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("without active guard", func(t *testing.T) {
+		guardtest.Run(t, guardtest.Suite{
+			Guard:          NewGuard("kontext", "ratelimit", newRateLimitGuard(t, 1), nil, nil),
+			AnonymousUsers: common.AnonymousUsers{0, 1},
+		})
+	})
+	t.Run("with active guard", func(t *testing.T) {
+		guardtest.Run(t, guardtest.Suite{
+			Guard: NewGuard(
+				"kontext", "ratelimit", newRateLimitGuard(t, 1), newConcurrencyGuard(t), &reportCollector{}),
+			AnonymousUsers: common.AnonymousUsers{0, 1},
+		})
+	})
+}
+
+func TestShadowDecisionNotApplied(t *testing.T) {
+	collector := &reportCollector{}
+	g := NewGuard("kontext", "ratelimit", newRateLimitGuard(t, 1), newConcurrencyGuard(t), collector)
+	for i := 0; i < 3; i++ {
+		eval := g.EvaluateRequest(guardtest.NewRequest("/", "192.0.2.10"), nil)
+		if eval.ProposedResponse != http.StatusOK {
+			t.Fatalf("expected the active decision 200, got %d", eval.ProposedResponse)
+		}
+		if eval.Release == nil {
+			t.Fatal("expected the active guard's Release hook")
+		}
+		eval.ReleaseResources()
+	}
+	if len(collector.reports) != 3 {
+		t.Fatalf("expected 3 reports, got %d", len(collector.reports))
+	}
+	if r := collector.reports[0]; !r.Agrees() || r.ShadowResponse != http.StatusOK {
+		t.Errorf("expected the first shadow decision to agree, got %d", r.ShadowResponse)
+	}
+	for _, r := range collector.reports[1:] {
+		if r.Agrees() || r.ShadowResponse != http.StatusTooManyRequests || r.ActiveResponse != http.StatusOK {
+			t.Errorf("expected a disagreeing shadow 429, got shadow %d, active %d", r.ShadowResponse, r.ActiveResponse)
+		}
+	}
+}
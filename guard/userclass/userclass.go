@@ -0,0 +1,211 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package userclass maps users and API keys to named classes
+// with their own limits (rate, concurrency, delay, quotas).
+package userclass
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/czcorpus/apiguard-common/common"
+	"github.com/czcorpus/apiguard-common/guard/apikey"
+)
+
+const (
+	dfltAPIKeyHeader = "X-Api-Key"
+)
+
+// RateLimit defines a token bucket for a class
+type RateLimit struct {
+	RatePerSec float64 `json:"ratePerSec"`
+	Burst      int     `json:"burst"`
+}
+
+// Quota defines maximum numbers of requests per calendar day
+// and month. Zero values mean "no limit".
+type Quota struct {
+	Daily   int64 `json:"daily"`
+	Monthly int64 `json:"monthly"`
+}
+
+func (q Quota) IsUnlimited() bool {
+	return q.Daily == 0 && q.Monthly == 0
+}
+
+// Class is a named group of users sharing the same limits.
+// All the limits are optional - a guard should use its own
+// configuration in case a limit is not defined for the class.
+type Class struct {
+	Name string `json:"name"`
+
+	// RateLimit overrides rate limiting guard buckets
+	RateLimit *RateLimit `json:"rateLimit"`
+
+	// MaxConcurrent overrides the concurrency guard per-client limit
+	MaxConcurrent int `json:"maxConcurrent"`
+
+	// MaxDelayMs caps delays calculated by the delay guard
+	MaxDelayMs int `json:"maxDelayMs"`
+
+	Quota Quota `json:"quota"`
+
+	// UserIDs lists members of the class
+	UserIDs []common.UserID `json:"userIds"`
+
+	// APIKeyHashes lists API keys (see apikey.HashKey) whose
+	// requests belong to the class
+	APIKeyHashes []string `json:"apiKeyHashes"`
+}
+
+func (c *Class) Validate(context string) error {
+	if c.Name == "" {
+		return fmt.Errorf("%s.name is missing", context)
+	}
+	if c.RateLimit != nil {
+		if c.RateLimit.RatePerSec <= 0 {
+			return fmt.Errorf("%s.rateLimit.ratePerSec must be a positive number", context)
+		}
+		if c.RateLimit.Burst < 1 {
+			return fmt.Errorf("%s.rateLimit.burst must be at least 1", context)
+		}
+	}
+	if c.MaxConcurrent < 0 || c.MaxDelayMs < 0 || c.Quota.Daily < 0 || c.Quota.Monthly < 0 {
+		return fmt.Errorf("%s: limits cannot be negative", context)
+	}
+	return nil
+}
+
+// Conf configures user classes.
+type Conf struct {
+	Classes []*Class `json:"classes"`
+
+	// DefaultClass is used for authenticated users not listed
+	// in any class
+	DefaultClass string `json:"defaultClass"`
+
+	// AnonymousClass is used for anonymous users. In case it is
+	// empty, DefaultClass is used.
+	AnonymousClass string `json:"anonymousClass"`
+
+	// APIKeyHeader is a request header containing an API key
+	APIKeyHeader string `json:"apiKeyHeader"`
+}
+
+func (conf *Conf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return fmt.Errorf("%s is missing", context)
+	}
+	names := make(map[string]bool)
+	for i, c := range conf.Classes {
+		if err := c.Validate(fmt.Sprintf("%s.classes[%d]", context, i)); err != nil {
+			return err
+		}
+		if names[c.Name] {
+			return fmt.Errorf("%s: duplicate class %s", context, c.Name)
+		}
+		names[c.Name] = true
+	}
+	if conf.DefaultClass == "" {
+		return fmt.Errorf("%s.defaultClass is missing", context)
+	}
+	if !names[conf.DefaultClass] {
+		return fmt.Errorf("%s.defaultClass %s is not defined", context, conf.DefaultClass)
+	}
+	if conf.AnonymousClass == "" {
+		conf.AnonymousClass = conf.DefaultClass
+
+	} else if !names[conf.AnonymousClass] {
+		return fmt.Errorf("%s.anonymousClass %s is not defined", context, conf.AnonymousClass)
+	}
+	if conf.APIKeyHeader == "" {
+		conf.APIKeyHeader = dfltAPIKeyHeader
+	}
+	return nil
+}
+
+// -----
+
+// Classifier determines classes of users. It is read-only once
+// created and therefore safe for concurrent use.
+type Classifier struct {
+	conf           *Conf
+	anonymousUsers common.AnonymousUsers
+	byName         map[string]*Class
+	byUser         map[common.UserID]*Class
+	byKeyHash      map[string]*Class
+}
+
+// ClassByName returns a class with the specified name or nil
+func (cl *Classifier) ClassByName(name string) *Class {
+	return cl.byName[name]
+}
+
+// ForUser returns a class of the user. Anonymous and invalid users
+// get the anonymous class, unlisted users get the default class.
+func (cl *Classifier) ForUser(userID common.UserID) *Class {
+	if c, ok := cl.byUser[userID]; ok {
+		return c
+	}
+	if !userID.IsValid() || cl.anonymousUsers.IsAnonymous(userID) {
+		return cl.byName[cl.conf.AnonymousClass]
+	}
+	return cl.byName[cl.conf.DefaultClass]
+}
+
+// ForAPIKeyHash returns a class assigned to the API key or nil
+// in case the key is not assigned to any class.
+func (cl *Classifier) ForAPIKeyHash(keyHash string) *Class {
+	return cl.byKeyHash[strings.ToLower(keyHash)]
+}
+
+// ForRequest returns a class for the request. An API key
+// with an assigned class takes precedence over the user ID.
+func (cl *Classifier) ForRequest(req *http.Request, userID common.UserID) *Class {
+	key := strings.TrimSpace(req.Header.Get(cl.conf.APIKeyHeader))
+	key = strings.TrimSpace(strings.TrimPrefix(key, "Bearer "))
+	if key != "" {
+		if c := cl.ForAPIKeyHash(apikey.HashKey(key)); c != nil {
+			return c
+		}
+	}
+	return cl.ForUser(userID)
+}
+
+// NewClassifier creates a new classifier. The conf is expected
+// to be already validated (see Conf.ValidateAndDefaults).
+func NewClassifier(conf *Conf, anonymousUsers common.AnonymousUsers) *Classifier {
+	ans := &Classifier{
+		conf:           conf,
+		anonymousUsers: anonymousUsers,
+		byName:         make(map[string]*Class),
+		byUser:         make(map[common.UserID]*Class),
+		byKeyHash:      make(map[string]*Class),
+	}
+	for _, c := range conf.Classes {
+		ans.byName[c.Name] = c
+		for _, uid := range c.UserIDs {
+			ans.byUser[uid] = c
+		}
+		for _, kh := range c.APIKeyHashes {
+			ans.byKeyHash[strings.ToLower(kh)] = c
+		}
+	}
+	return ans
+}
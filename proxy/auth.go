@@ -0,0 +1,143 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/czcorpus/apiguard-common/guard"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DfltClientIDHeader = "X-Api-Client-Id"
+	DfltHumanIDHeader  = "X-Api-Human-Id"
+
+	AuthIdentityUser     AuthIdentity = "user"
+	AuthIdentityFallback AuthIdentity = "fallback"
+	AuthIdentityNone     AuthIdentity = "none"
+)
+
+// AuthIdentity describes which identity has been used
+// to authenticate a request forwarded to a backend.
+type AuthIdentity string
+
+// AuthForwardingConf specifies how user identity is passed
+// to a backend.
+type AuthForwardingConf struct {
+
+	// AuthCookieNames lists user cookies used for authentication.
+	// These are replaced by the fallback cookie (if required)
+	// or removed in case the evaluation forbids access.
+	AuthCookieNames []string `json:"authCookieNames"`
+
+	// ClientIDHeader is a header name used to pass ReqEvaluation.ClientID.
+	// If empty, DfltClientIDHeader is used.
+	ClientIDHeader string `json:"clientIdHeader"`
+
+	// HumanIDHeader is a header name used to pass ReqEvaluation.HumanID.
+	// If empty, DfltHumanIDHeader is used.
+	HumanIDHeader string `json:"humanIdHeader"`
+}
+
+func (conf AuthForwardingConf) clientIDHeader() string {
+	if conf.ClientIDHeader == "" {
+		return DfltClientIDHeader
+	}
+	return conf.ClientIDHeader
+}
+
+func (conf AuthForwardingConf) humanIDHeader() string {
+	if conf.HumanIDHeader == "" {
+		return DfltHumanIDHeader
+	}
+	return conf.HumanIDHeader
+}
+
+// stripCookies removes all the cookies with the specified names
+// from the request
+func stripCookies(req *http.Request, names []string) {
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, c := range cookies {
+		if !slices.Contains(names, c.Name) {
+			req.AddCookie(c)
+		}
+	}
+}
+
+// PrepareAuthForwarding modifies an outgoing backend request based
+// on the guard's evaluation:
+//   - in case the evaluation requires the fallback cookie, user's auth
+//     cookies are replaced by the fallback one,
+//   - in case the evaluation forbids access, user's auth cookies are removed,
+//   - user identity headers are always set based on the evaluation (or removed
+//     if the respective ID is not valid) so a client cannot spoof them.
+//
+// The clientReq is the original incoming request (it is used only for logging).
+// The function returns an identity which has been used for the request.
+func PrepareAuthForwarding(
+	clientReq *http.Request,
+	req *http.Request,
+	eval guard.ReqEvaluation,
+	fallbackCookie *http.Cookie,
+	conf AuthForwardingConf,
+) AuthIdentity {
+	toStrip := make([]string, 0, len(conf.AuthCookieNames)+1)
+	if fallbackCookie != nil {
+		// a client must never provide the fallback cookie by itself
+		toStrip = append(toStrip, fallbackCookie.Name)
+	}
+	ans := AuthIdentityUser
+	if eval.RequiresFallbackCookie {
+		toStrip = append(toStrip, conf.AuthCookieNames...)
+		if fallbackCookie != nil {
+			ans = AuthIdentityFallback
+
+		} else {
+			log.Warn().Msg("evaluation requires fallback cookie but none is configured")
+			ans = AuthIdentityNone
+		}
+
+	} else if eval.ForbidsAccess() {
+		toStrip = append(toStrip, conf.AuthCookieNames...)
+		ans = AuthIdentityNone
+	}
+	stripCookies(req, toStrip)
+	if ans == AuthIdentityFallback {
+		req.AddCookie(fallbackCookie)
+	}
+
+	req.Header.Del(conf.clientIDHeader())
+	if eval.ClientID.IsValid() {
+		req.Header.Set(conf.clientIDHeader(), eval.ClientID.String())
+	}
+	req.Header.Del(conf.humanIDHeader())
+	if eval.HumanID.IsValid() {
+		req.Header.Set(conf.humanIDHeader(), eval.HumanID.String())
+	}
+
+	log.Debug().
+		Str("authIdentity", string(ans)).
+		Str("clientId", eval.ClientID.String()).
+		Str("humanId", eval.HumanID.String()).
+		Str("ipAddress", guard.ClientIPString(clientReq)).
+		Msg("prepared backend request authentication")
+	return ans
+}
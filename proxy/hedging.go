@@ -0,0 +1,271 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltHedgingPercentile   = 0.95
+	dfltHedgingWindowSize   = 200
+	dfltHedgingMinSamples   = 20
+	dfltHedgingBudgetRatio  = 0.05
+	dfltHedgingMaxBudget    = 10.0
+	dfltHedgingMaxDelayMs   = 1000
+	hedgingPrimaryAttempt   = 0
+	hedgingSecondaryAttempt = 1
+)
+
+// HedgingConf configures request hedging for latency sensitive
+// services. With hedging, in case a backend does not respond within
+// a delay derived from recent latencies, a second request is sent to another
+// backend instance and the first response wins.
+type HedgingConf struct {
+	Enabled bool `json:"enabled"`
+
+	// Percentile (0, 1) of recent latencies used as the hedging delay
+	Percentile float64 `json:"percentile"`
+
+	// WindowSize specifies how many recent latencies are considered
+	WindowSize int `json:"windowSize"`
+
+	// MinSamples specifies how many latencies must be recorded before
+	// the percentile is used. Until then, MaxDelayMs is applied.
+	MinSamples int `json:"minSamples"`
+
+	MinDelayMs int `json:"minDelayMs"`
+
+	MaxDelayMs int `json:"maxDelayMs"`
+
+	// BudgetRatio caps the number of extra requests as a fraction
+	// of all requests (e.g. 0.05 means at most 5% extra requests)
+	BudgetRatio float64 `json:"budgetRatio"`
+}
+
+func (conf *HedgingConf) ValidateAndDefaults(context string) error {
+	if conf == nil || !conf.Enabled {
+		return nil
+	}
+	if conf.Percentile == 0 {
+		conf.Percentile = dfltHedgingPercentile
+	}
+	if conf.Percentile <= 0 || conf.Percentile >= 1 {
+		return fmt.Errorf("%s.percentile must be from the (0, 1) interval", context)
+	}
+	if conf.WindowSize == 0 {
+		conf.WindowSize = dfltHedgingWindowSize
+	}
+	if conf.MinSamples == 0 {
+		conf.MinSamples = dfltHedgingMinSamples
+	}
+	if conf.MinSamples > conf.WindowSize {
+		return fmt.Errorf("%s.minSamples cannot be greater than %s.windowSize", context, context)
+	}
+	if conf.MaxDelayMs == 0 {
+		conf.MaxDelayMs = dfltHedgingMaxDelayMs
+	}
+	if conf.MinDelayMs < 0 || conf.MinDelayMs > conf.MaxDelayMs {
+		return fmt.Errorf("%s.minDelayMs must be between 0 and %s.maxDelayMs", context, context)
+	}
+	if conf.BudgetRatio == 0 {
+		conf.BudgetRatio = dfltHedgingBudgetRatio
+	}
+	if conf.BudgetRatio < 0 || conf.BudgetRatio > 1 {
+		return fmt.Errorf("%s.budgetRatio must be from the [0, 1] interval", context)
+	}
+	return nil
+}
+
+// ErrNoBackendResponse is used in case a HedgedCall returns nil
+var ErrNoBackendResponse = errors.New("backend call returned no response")
+
+// -----
+
+// HedgedCall performs an actual backend request. The attempt argument
+// is 0 for the primary request and 1 for the hedged one. Implementations
+// are expected to use a different backend instance for different attempts
+// and to respect the ctx (which is cancelled for the losing request).
+type HedgedCall func(ctx context.Context, attempt int) BackendResponse
+
+type hedgedResult struct {
+	attempt int
+	resp    BackendResponse
+}
+
+// hedgedResponse binds a winning response with its context cancel function
+// so the context is released once the response body is closed.
+type hedgedResponse struct {
+	BackendResponse
+	cancel context.CancelFunc
+}
+
+func (hr *hedgedResponse) CloseBodyReader() error {
+	defer hr.cancel()
+	return hr.BackendResponse.CloseBodyReader()
+}
+
+// -----
+
+// Hedger performs hedged backend requests. It keeps a window
+// of recent latencies to determine hedging delay and a budget
+// limiting the number of extra requests.
+// Hedger is safe for concurrent use.
+type Hedger struct {
+	conf      HedgingConf
+	latencies *collections.CircularList[time.Duration]
+	budget    float64
+	mu        sync.Mutex
+}
+
+func (h *Hedger) recordLatency(d time.Duration) {
+	h.mu.Lock()
+	h.latencies.Append(d)
+	h.mu.Unlock()
+}
+
+// HedgingDelay returns the current delay after which a hedged
+// request is started.
+func (h *Hedger) HedgingDelay() time.Duration {
+	minDelay := time.Duration(h.conf.MinDelayMs) * time.Millisecond
+	maxDelay := time.Duration(h.conf.MaxDelayMs) * time.Millisecond
+	h.mu.Lock()
+	if h.latencies.Len() < h.conf.MinSamples {
+		h.mu.Unlock()
+		return maxDelay
+	}
+	values := make([]time.Duration, 0, h.latencies.Len())
+	h.latencies.ForEach(func(i int, item time.Duration) bool {
+		values = append(values, item)
+		return true
+	})
+	h.mu.Unlock()
+	slices.Sort(values)
+	idx := int(math.Ceil(h.conf.Percentile*float64(len(values)))) - 1
+	ans := values[max(idx, 0)]
+	return min(max(ans, minDelay), maxDelay)
+}
+
+// addToBudget is called for each primary request
+func (h *Hedger) addToBudget() {
+	h.mu.Lock()
+	h.budget = min(h.budget+h.conf.BudgetRatio, dfltHedgingMaxBudget)
+	h.mu.Unlock()
+}
+
+// takeFromBudget tries to consume a single hedged request
+// from the budget.
+func (h *Hedger) takeFromBudget() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.budget >= 1 {
+		h.budget--
+		return true
+	}
+	return false
+}
+
+// Do performs the call with optional hedging. The first successful
+// response is returned and the other request (if any) is cancelled.
+// In case hedging is disabled, the call is performed directly.
+func (h *Hedger) Do(ctx context.Context, call HedgedCall) BackendResponse {
+	if !h.conf.Enabled {
+		return call(ctx, hedgingPrimaryAttempt)
+	}
+	h.addToBudget()
+	t0 := time.Now()
+	results := make(chan hedgedResult, 2)
+	cancels := make([]context.CancelFunc, 0, 2)
+	start := func(attempt int) {
+		aCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp := call(aCtx, attempt)
+			if resp == nil {
+				resp = &BackendSimpleResponse{
+					BodyReader: EmptyReadCloser{},
+					Err:        ErrNoBackendResponse,
+				}
+			}
+			results <- hedgedResult{attempt: attempt, resp: resp}
+		}()
+	}
+	start(hedgingPrimaryAttempt)
+	timer := time.NewTimer(h.HedgingDelay())
+	defer timer.Stop()
+	running := 1
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) == 1 && h.takeFromBudget() {
+				log.Debug().
+					Dur("elapsed", time.Since(t0)).
+					Msg("starting hedged backend request")
+				start(hedgingSecondaryAttempt)
+				running++
+			}
+		case res := <-results:
+			running--
+			if res.resp.Error() == nil || running == 0 {
+				h.recordLatency(time.Since(t0))
+				for i, cancel := range cancels {
+					if i != res.attempt {
+						cancel()
+					}
+				}
+				if running > 0 {
+					go func() {
+						loser := <-results
+						if loser.resp.Error() == nil {
+							loser.resp.CloseBodyReader()
+						}
+					}()
+				}
+				return &hedgedResponse{
+					BackendResponse: res.resp,
+					cancel:          cancels[res.attempt],
+				}
+			}
+		}
+	}
+}
+
+// NewHedger creates a new Hedger. The conf is validated and missing
+// values are set to their defaults (see HedgingConf.ValidateAndDefaults).
+func NewHedger(conf HedgingConf) (*Hedger, error) {
+	if err := conf.ValidateAndDefaults("hedging"); err != nil {
+		return nil, fmt.Errorf("failed to create hedger: %w", err)
+	}
+	windowSize := conf.WindowSize
+	if windowSize == 0 {
+		windowSize = dfltHedgingWindowSize
+	}
+	return &Hedger{
+		conf:      conf,
+		latencies: collections.NewCircularList[time.Duration](windowSize),
+	}, nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/proxy"
+	"github.com/czcorpus/apiguard-common/proxy/proxytest"
+)
+
+func mustHedger(t *testing.T, conf proxy.HedgingConf) *proxy.Hedger {
+	t.Helper()
+	h, err := proxy.NewHedger(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// twoBackends returns a HedgedCall using the primary backend for the first
+// attempt and the secondary one for the hedged attempt. Context errors
+// observed by the attempts are sent to ctxErrs.
+func twoBackends(primary, secondary *proxytest.MockBackend, ctxErrs chan<- error) proxy.HedgedCall {
+	return func(ctx context.Context, attempt int) proxy.BackendResponse {
+		backend := primary
+		if attempt > 0 {
+			backend = secondary
+		}
+		resp := backend.Call(ctx)
+		if ctxErrs != nil {
+			ctxErrs <- ctx.Err()
+		}
+		return resp
+	}
+}
+
+func readBody(t *testing.T, resp proxy.BackendResponse) string {
+	t.Helper()
+	if resp.Error() != nil {
+		t.Fatalf("unexpected response error: %s", resp.Error())
+	}
+	data, err := io.ReadAll(resp.GetBodyReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.CloseBodyReader()
+	return string(data)
+}
+
+func TestNewHedgerValidatesConf(t *testing.T) {
+	if _, err := proxy.NewHedger(proxy.HedgingConf{Enabled: true, Percentile: 1.5}); err == nil {
+		t.Error("expected an error for an invalid percentile")
+	}
+	h := mustHedger(t, proxy.HedgingConf{Enabled: true})
+	// without samples, the default max. delay is applied
+	if d := h.HedgingDelay(); d != time.Second {
+		t.Errorf("HedgingDelay() = %v, want %v", d, time.Second)
+	}
+}
+
+func TestHedgingDelayFollowsLatencies(t *testing.T) {
+	h := mustHedger(t, proxy.HedgingConf{
+		Enabled:     true,
+		MinSamples:  5,
+		WindowSize:  10,
+		MaxDelayMs:  500,
+		BudgetRatio: 0.01,
+	})
+	backend := &proxytest.MockBackend{Body: []byte("ok"), Delay: 20 * time.Millisecond}
+	for i := 0; i < 5; i++ {
+		readBody(t, h.Do(context.Background(), twoBackends(backend, backend, nil)))
+	}
+	d := h.HedgingDelay()
+	if d < 20*time.Millisecond || d >= 500*time.Millisecond {
+		t.Errorf("HedgingDelay() = %v, want approx. 20ms", d)
+	}
+}
+
+func TestHedgingFirstSuccessWins(t *testing.T) {
+	h := mustHedger(t, proxy.HedgingConf{
+		Enabled:     true,
+		MaxDelayMs:  20,
+		BudgetRatio: 1,
+	})
+	primary := &proxytest.MockBackend{Body: []byte("primary"), Delay: time.Second}
+	secondary := &proxytest.MockBackend{Body: []byte("secondary")}
+	ctxErrs := make(chan error, 2)
+	t0 := time.Now()
+	resp := h.Do(context.Background(), twoBackends(primary, secondary, ctxErrs))
+	if body := readBody(t, resp); body != "secondary" {
+		t.Errorf("body = %s, want secondary", body)
+	}
+	if elapsed := time.Since(t0); elapsed >= time.Second {
+		t.Errorf("hedged request took %v", elapsed)
+	}
+	// secondary finishes first, then the cancelled primary
+	<-ctxErrs
+	select {
+	case err := <-ctxErrs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("losing request context error = %v, want context.Canceled", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("losing request has not been cancelled")
+	}
+	if primary.NumCalls() != 1 || secondary.NumCalls() != 1 {
+		t.Errorf("calls = %d/%d, want 1/1", primary.NumCalls(), secondary.NumCalls())
+	}
+}
+
+func TestHedgingFailedAttemptDoesNotWin(t *testing.T) {
+	h := mustHedger(t, proxy.HedgingConf{
+		Enabled:     true,
+		MaxDelayMs:  10,
+		BudgetRatio: 1,
+	})
+	primary := &proxytest.MockBackend{Body: []byte("primary"), Delay: 50 * time.Millisecond}
+	secondary := &proxytest.MockBackend{Err: errors.New("backend failure")}
+	resp := h.Do(context.Background(), twoBackends(primary, secondary, nil))
+	if body := readBody(t, resp); body != "primary" {
+		t.Errorf("body = %s, want primary", body)
+	}
+}
+
+func TestHedgingBudgetCap(t *testing.T) {
+	h := mustHedger(t, proxy.HedgingConf{
+		Enabled:     true,
+		MaxDelayMs:  5,
+		BudgetRatio: 0.25,
+	})
+	primary := &proxytest.MockBackend{Body: []byte("primary"), Delay: 30 * time.Millisecond}
+	secondary := &proxytest.MockBackend{Body: []byte("secondary")}
+	for i := 0; i < 8; i++ {
+		readBody(t, h.Do(context.Background(), twoBackends(primary, secondary, nil)))
+	}
+	// each primary request adds 0.25 to the budget => 2 hedged requests
+	if n := secondary.NumCalls(); n != 2 {
+		t.Errorf("hedged requests = %d, want 2", n)
+	}
+}
+
+func TestHedgingNilResponse(t *testing.T) {
+	h := mustHedger(t, proxy.HedgingConf{Enabled: true, MaxDelayMs: 10, BudgetRatio: 1})
+	resp := h.Do(context.Background(), func(ctx context.Context, attempt int) proxy.BackendResponse {
+		return nil
+	})
+	if !errors.Is(resp.Error(), proxy.ErrNoBackendResponse) {
+		t.Errorf("Error() = %v, want ErrNoBackendResponse", resp.Error())
+	}
+}
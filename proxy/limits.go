@@ -0,0 +1,164 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// BodySizeLimitConf configures maximum accepted sizes of backend
+// response bodies. A zero or negative value means "no limit".
+type BodySizeLimitConf struct {
+
+	// DefaultMaxBytes is applied to services without a specific limit
+	DefaultMaxBytes int64 `json:"defaultMaxBytes"`
+
+	// Services contains service specific limits (service name => bytes)
+	Services map[string]int64 `json:"services"`
+
+	// ExceededStatus is an HTTP status returned to a client in case
+	// a limit is exceeded. Only 502 (default) and 413 are supported.
+	ExceededStatus int `json:"exceededStatus"`
+}
+
+func (conf *BodySizeLimitConf) ValidateAndDefaults(context string) error {
+	if conf == nil {
+		return nil
+	}
+	if conf.ExceededStatus == 0 {
+		conf.ExceededStatus = http.StatusBadGateway
+	}
+	if conf.ExceededStatus != http.StatusBadGateway &&
+		conf.ExceededStatus != http.StatusRequestEntityTooLarge {
+		return fmt.Errorf("%s.exceededStatus must be either 502 or 413", context)
+	}
+	if conf.DefaultMaxBytes < 0 {
+		return fmt.Errorf("%s.defaultMaxBytes cannot be negative", context)
+	}
+	for srv, v := range conf.Services {
+		if v < 0 {
+			return fmt.Errorf("%s.services.%s cannot be negative", context, srv)
+		}
+	}
+	return nil
+}
+
+// LimitFor returns a body size limit for a specified service.
+// Zero means there is no limit.
+func (conf *BodySizeLimitConf) LimitFor(service string) int64 {
+	if conf == nil {
+		return 0
+	}
+	if v, ok := conf.Services[service]; ok {
+		return v
+	}
+	return conf.DefaultMaxBytes
+}
+
+// -----
+
+// ResponseTooLargeError is returned by readers once a backend
+// response body exceeds a configured limit.
+type ResponseTooLargeError struct {
+	Limit int64
+}
+
+func (err *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("backend response body exceeds the limit of %d bytes", err.Limit)
+}
+
+// IsResponseTooLarge tests whether the err is (or wraps) ResponseTooLargeError
+func IsResponseTooLarge(err error) bool {
+	var tErr *ResponseTooLargeError
+	return errors.As(err, &tErr)
+}
+
+// -----
+
+// LimitedReadCloser is a io.ReadCloser which fails with ResponseTooLargeError
+// once more than Limit bytes are read from the wrapped reader.
+// Unlike io.LimitedReader, it does not silently truncate the data.
+type LimitedReadCloser struct {
+	rc    io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (lrc *LimitedReadCloser) Read(p []byte) (int, error) {
+	if lrc.read > lrc.limit {
+		return 0, &ResponseTooLargeError{Limit: lrc.limit}
+	}
+	// we allow for reading one extra byte so we can
+	// detect overflow without a need for another read
+	if rem := lrc.limit - lrc.read + 1; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	n, err := lrc.rc.Read(p)
+	lrc.read += int64(n)
+	if lrc.read > lrc.limit {
+		return n, &ResponseTooLargeError{Limit: lrc.limit}
+	}
+	return n, err
+}
+
+func (lrc *LimitedReadCloser) Close() error {
+	return lrc.rc.Close()
+}
+
+// NewLimitedReadCloser wraps rc so it fails when reading more than
+// limit bytes. For limit <= 0, the original reader is returned.
+func NewLimitedReadCloser(rc io.ReadCloser, limit int64) io.ReadCloser {
+	if limit <= 0 {
+		return rc
+	}
+	return &LimitedReadCloser{rc: rc, limit: limit}
+}
+
+// -----
+
+// ReadBodyLimited reads whole body of a backend response while respecting
+// the provided limit. In case the response declares its size via
+// the Content-Length header, the limit is tested before any reading.
+// For limit <= 0, the function behaves just like io.ReadAll.
+func ReadBodyLimited(resp BackendResponse, limit int64) ([]byte, error) {
+	if limit > 0 {
+		cl, err := strconv.ParseInt(resp.GetHeaders().Get("Content-Length"), 10, 64)
+		if err == nil && cl > limit {
+			return nil, &ResponseTooLargeError{Limit: limit}
+		}
+	}
+	return io.ReadAll(NewLimitedReadCloser(resp.GetBodyReader(), limit))
+}
+
+// ReadErrorStatus returns a proper HTTP status for an error
+// encountered while reading a backend response. For an exceeded size limit,
+// the exceededStatus is used (with 502 as a fallback if zero),
+// for other errors it is 500.
+func ReadErrorStatus(err error, exceededStatus int) int {
+	if IsResponseTooLarge(err) {
+		if exceededStatus == 0 {
+			return http.StatusBadGateway
+		}
+		return exceededStatus
+	}
+	return http.StatusInternalServerError
+}
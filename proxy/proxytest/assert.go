@@ -0,0 +1,72 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"testing"
+
+	"github.com/czcorpus/apiguard-common/proxy"
+)
+
+// AssertCacheHit fails the test in case the processor
+// does not report a cache hit.
+func AssertCacheHit(t testing.TB, rp proxy.ResponseProcessor) {
+	t.Helper()
+	if !rp.IsCacheHit() {
+		t.Errorf("expected cache hit, got miss (%v)", rp)
+	}
+}
+
+// AssertCacheMiss fails the test in case the processor
+// reports a cache hit.
+func AssertCacheMiss(t testing.TB, rp proxy.ResponseProcessor) {
+	t.Helper()
+	if rp.IsCacheHit() {
+		t.Errorf("expected cache miss, got hit (%v)", rp)
+	}
+}
+
+// AssertCacheStats fails the test in case the cache recorded
+// different numbers of hits and misses.
+func AssertCacheStats(t testing.TB, mc *MemoryCache, hits, misses int) {
+	t.Helper()
+	if h := mc.NumHits(); h != hits {
+		t.Errorf("expected %d cache hits, got %d", hits, h)
+	}
+	if m := mc.NumMisses(); m != misses {
+		t.Errorf("expected %d cache misses, got %d", misses, m)
+	}
+}
+
+// AssertNumBackendCalls fails the test in case the backend
+// has been called a different number of times.
+func AssertNumBackendCalls(t testing.TB, mb *MockBackend, num int) {
+	t.Helper()
+	if n := mb.NumCalls(); n != num {
+		t.Errorf("expected %d backend calls, got %d", num, n)
+	}
+}
+
+// AssertStatus fails the test in case the writer recorded
+// a different HTTP status.
+func AssertStatus(t testing.TB, rw *RecordingWriter, status int) {
+	t.Helper()
+	if s := rw.Status(); s != status {
+		t.Errorf("expected HTTP status %d, got %d", status, s)
+	}
+}
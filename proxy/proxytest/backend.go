@@ -0,0 +1,234 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proxytest provides utilities for testing guards, proxies
+// and other code working with backend responses and caches.
+package proxytest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/proxy"
+)
+
+// MockReadCloser is a body reader which remembers whether it has been
+// closed. It can also emit data in chunks with a delay between them
+// to simulate streaming backends.
+type MockReadCloser struct {
+	chunks     [][]byte
+	chunkDelay time.Duration
+	curr       *bytes.Reader
+	closed     bool
+	mu         sync.Mutex
+}
+
+func (rc *MockReadCloser) Read(p []byte) (int, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.closed {
+		return 0, io.ErrClosedPipe
+	}
+	for rc.curr == nil || rc.curr.Len() == 0 {
+		if len(rc.chunks) == 0 {
+			return 0, io.EOF
+		}
+		if rc.curr != nil && rc.chunkDelay > 0 {
+			rc.mu.Unlock()
+			time.Sleep(rc.chunkDelay)
+			rc.mu.Lock()
+		}
+		rc.curr = bytes.NewReader(rc.chunks[0])
+		rc.chunks = rc.chunks[1:]
+	}
+	return rc.curr.Read(p)
+}
+
+func (rc *MockReadCloser) Close() error {
+	rc.mu.Lock()
+	rc.closed = true
+	rc.mu.Unlock()
+	return nil
+}
+
+// IsClosed tells whether Close() has been called
+func (rc *MockReadCloser) IsClosed() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.closed
+}
+
+// -----
+
+// MockResponse is a non-streamed backend response. Unlike
+// proxy.BackendSimpleResponse, it provides configurable headers.
+type MockResponse struct {
+	BodyReader io.ReadCloser
+	Headers    http.Header
+	StatusCode int
+	Err        error
+}
+
+func (mr *MockResponse) GetBodyReader() io.ReadCloser {
+	return mr.BodyReader
+}
+
+func (mr *MockResponse) CloseBodyReader() error {
+	return mr.BodyReader.Close()
+}
+
+func (mr *MockResponse) GetHeaders() http.Header {
+	return mr.Headers
+}
+
+func (mr *MockResponse) GetStatusCode() int {
+	return mr.StatusCode
+}
+
+func (mr *MockResponse) Error() error {
+	return mr.Err
+}
+
+func (mr *MockResponse) IsDataStream() bool {
+	return false
+}
+
+// -----
+
+// MockBackend is a scriptable fake backend. Each call produces
+// a new BackendResponse based on the configured properties.
+// In case Chunks is set, the response is a proxy.BackendStreamResponse
+// emitting the chunks with ChunkDelay between them, otherwise
+// a MockResponse with Body and Headers is produced.
+type MockBackend struct {
+	Status     int
+	Headers    http.Header
+	Body       []byte
+	Delay      time.Duration
+	Err        error
+	Chunks     []string
+	ChunkDelay time.Duration
+
+	numCalls int
+	bodies   []*MockReadCloser
+	mu       sync.Mutex
+}
+
+// Call produces a response. The delay (if any) respects the context
+// in which case a response with the context error is returned.
+func (mb *MockBackend) Call(ctx context.Context) proxy.BackendResponse {
+	mb.mu.Lock()
+	mb.numCalls++
+	mb.mu.Unlock()
+	if mb.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return &proxy.BackendSimpleResponse{Err: ctx.Err()}
+		case <-time.After(mb.Delay):
+		}
+	}
+	if mb.Err != nil {
+		return &proxy.BackendSimpleResponse{StatusCode: mb.Status, Err: mb.Err}
+	}
+	body := &MockReadCloser{chunkDelay: mb.ChunkDelay}
+	if mb.Chunks != nil {
+		for _, ch := range mb.Chunks {
+			body.chunks = append(body.chunks, []byte(ch))
+		}
+
+	} else {
+		body.chunks = [][]byte{mb.Body}
+	}
+	mb.mu.Lock()
+	mb.bodies = append(mb.bodies, body)
+	mb.mu.Unlock()
+	status := mb.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	headers := mb.Headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	if mb.Chunks != nil {
+		return &proxy.BackendStreamResponse{
+			BodyReader: body,
+			Headers:    headers,
+			StatusCode: status,
+		}
+	}
+	return &MockResponse{
+		BodyReader: body,
+		Headers:    headers,
+		StatusCode: status,
+	}
+}
+
+// CallFn returns a function suitable for ResponseProcessor.HandleCacheMiss
+func (mb *MockBackend) CallFn() func() proxy.BackendResponse {
+	return func() proxy.BackendResponse {
+		return mb.Call(context.Background())
+	}
+}
+
+// HedgedCall returns a function suitable for proxy.Hedger.Do
+func (mb *MockBackend) HedgedCall() proxy.HedgedCall {
+	return func(ctx context.Context, attempt int) proxy.BackendResponse {
+		return mb.Call(ctx)
+	}
+}
+
+// NumCalls returns number of performed calls
+func (mb *MockBackend) NumCalls() int {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return mb.numCalls
+}
+
+// AllBodiesClosed tells whether all the produced response
+// bodies have been closed
+func (mb *MockBackend) AllBodiesClosed() bool {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	for _, b := range mb.bodies {
+		if !b.IsClosed() {
+			return false
+		}
+	}
+	return true
+}
+
+// NewSSEBackend creates a MockBackend producing Server-Sent Events
+// with the provided event data.
+func NewSSEBackend(chunkDelay time.Duration, events ...string) *MockBackend {
+	chunks := make([]string, len(events))
+	for i, e := range events {
+		chunks[i] = "data: " + e + "\n\n"
+	}
+	headers := http.Header{}
+	headers.Set("Content-Type", "text/event-stream")
+	return &MockBackend{
+		Status:     http.StatusOK,
+		Headers:    headers,
+		Chunks:     chunks,
+		ChunkDelay: chunkDelay,
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/czcorpus/apiguard-common/cache"
+)
+
+const (
+	CacheOpGet CacheOp = "get"
+	CacheOpSet CacheOp = "set"
+)
+
+type CacheOp string
+
+// CacheCall is a record of a single MemoryCache method call
+type CacheCall struct {
+	Op   CacheOp
+	Key  string
+	Hit  bool
+	Tag  string
+	Opts cache.CacheEntryOptions
+}
+
+// MemoryCache is an in-memory implementation of cache.Cache
+// recording all the calls for later inspection.
+// A cache miss is represented by a zero CacheEntry and a nil error.
+// POST requests are handled only with the CachingWithCacheablePOST option
+// (in other cases, Get always misses and Set is ignored).
+type MemoryCache struct {
+	data  map[string]cache.CacheEntry
+	calls []CacheCall
+	mu    sync.Mutex
+}
+
+func (mc *MemoryCache) mkKey(req *http.Request, opts cache.CacheEntryOptions) string {
+	var key strings.Builder
+	key.WriteString(req.Method)
+	key.WriteString(" ")
+	key.WriteString(req.URL.String())
+	for _, c := range opts.RespectCookies {
+		if cookie, err := req.Cookie(c); err == nil {
+			key.WriteString(fmt.Sprintf("|%s=%s", c, cookie.Value))
+		}
+	}
+	if opts.CacheablePOST {
+		key.WriteString("|")
+		key.Write(opts.RequestBody)
+	}
+	return key.String()
+}
+
+func (mc *MemoryCache) Get(req *http.Request, opts ...func(*cache.CacheEntryOptions)) (cache.CacheEntry, error) {
+	var o cache.CacheEntryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	key := mc.mkKey(req, o)
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	var ans cache.CacheEntry
+	if req.Method != http.MethodPost || o.CacheablePOST {
+		ans = mc.data[key]
+	}
+	mc.calls = append(mc.calls, CacheCall{Op: CacheOpGet, Key: key, Hit: !ans.IsZero(), Tag: o.Tag, Opts: o})
+	return ans, nil
+}
+
+func (mc *MemoryCache) Set(req *http.Request, value cache.CacheEntry, opts ...func(*cache.CacheEntryOptions)) error {
+	var o cache.CacheEntryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	key := mc.mkKey(req, o)
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if req.Method != http.MethodPost || o.CacheablePOST {
+		mc.data[key] = value
+	}
+	mc.calls = append(mc.calls, CacheCall{Op: CacheOpSet, Key: key, Tag: o.Tag, Opts: o})
+	return nil
+}
+
+// Calls returns all the recorded calls
+func (mc *MemoryCache) Calls() []CacheCall {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	ans := make([]CacheCall, len(mc.calls))
+	copy(ans, mc.calls)
+	return ans
+}
+
+// NumHits returns number of Get calls which found an entry
+func (mc *MemoryCache) NumHits() int {
+	return mc.countCalls(func(c CacheCall) bool { return c.Op == CacheOpGet && c.Hit })
+}
+
+// NumMisses returns number of Get calls which did not find any entry
+func (mc *MemoryCache) NumMisses() int {
+	return mc.countCalls(func(c CacheCall) bool { return c.Op == CacheOpGet && !c.Hit })
+}
+
+// NumSets returns number of Set calls
+func (mc *MemoryCache) NumSets() int {
+	return mc.countCalls(func(c CacheCall) bool { return c.Op == CacheOpSet })
+}
+
+func (mc *MemoryCache) countCalls(pred func(c CacheCall) bool) int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	var ans int
+	for _, c := range mc.calls {
+		if pred(c) {
+			ans++
+		}
+	}
+	return ans
+}
+
+// Reset removes all the cached data and recorded calls
+func (mc *MemoryCache) Reset() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.data = make(map[string]cache.CacheEntry)
+	mc.calls = nil
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		data: make(map[string]cache.CacheEntry),
+	}
+}
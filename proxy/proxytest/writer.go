@@ -0,0 +1,99 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxytest
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+)
+
+// RecordingWriter is an http.ResponseWriter (and http.Flusher) which
+// records everything written. Unlike httptest.ResponseRecorder,
+// it also keeps data split by individual flushes which is handy
+// for testing streamed responses.
+type RecordingWriter struct {
+	headers     http.Header
+	status      int
+	body        bytes.Buffer
+	unflushed   bytes.Buffer
+	flushed     []string
+	wroteHeader bool
+	mu          sync.Mutex
+}
+
+func (rw *RecordingWriter) Header() http.Header {
+	return rw.headers
+}
+
+func (rw *RecordingWriter) WriteHeader(status int) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.wroteHeader {
+		return
+	}
+	rw.status = status
+	rw.wroteHeader = true
+}
+
+func (rw *RecordingWriter) Write(data []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.unflushed.Write(data)
+	return rw.body.Write(data)
+}
+
+func (rw *RecordingWriter) Flush() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.unflushed.Len() > 0 {
+		rw.flushed = append(rw.flushed, rw.unflushed.String())
+		rw.unflushed.Reset()
+	}
+}
+
+// Status returns written HTTP status (or 0 if nothing has been written yet)
+func (rw *RecordingWriter) Status() int {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.status
+}
+
+// Body returns all the written data
+func (rw *RecordingWriter) Body() []byte {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return bytes.Clone(rw.body.Bytes())
+}
+
+// Flushes returns written data split by individual Flush() calls.
+// Flushes without any written data are not recorded.
+func (rw *RecordingWriter) Flushes() []string {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	ans := make([]string, len(rw.flushed))
+	copy(ans, rw.flushed)
+	return ans
+}
+
+func NewRecordingWriter() *RecordingWriter {
+	return &RecordingWriter{
+		headers: http.Header{},
+	}
+}
@@ -20,10 +20,12 @@ package proxy
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"time"
 
+	"github.com/czcorpus/apiguard-common/reporting"
 	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/rs/zerolog/log"
 )
 
 // ResponseProcessor is an abstraction for handling cache-aware response processing.
@@ -70,8 +72,41 @@ type ResponseProcessor interface {
 // DirectResponse handles response delivery by bypassing cache entirely,
 // writing response data directly to client without caching.
 type DirectResponse struct {
-	error     error
-	boundResp BackendResponse
+	error           error
+	boundResp       BackendResponse
+	maxBodySize     int64
+	exceededStatus  int
+	service         string
+	reportingWriter reporting.ReportingWriter
+}
+
+// DirectRespWithBodyLimit sets a maximum size of a backend response
+// body the DirectResponse is willing to read. Once exceeded, the client
+// receives the exceededStatus (502 if zero) and the Error() method
+// reports ResponseTooLargeError.
+func DirectRespWithBodyLimit(maxBytes int64, exceededStatus int) func(*DirectResponse) {
+	return func(ncw *DirectResponse) {
+		ncw.maxBodySize = maxBytes
+		ncw.exceededStatus = exceededStatus
+	}
+}
+
+// DirectRespWithServiceLimit applies a body size limit configured
+// for the service (see BodySizeLimitConf.LimitFor). Rejected responses
+// are reported via the reportingWriter (which may be nil).
+func DirectRespWithServiceLimit(
+	service string,
+	conf *BodySizeLimitConf,
+	reportingWriter reporting.ReportingWriter,
+) func(*DirectResponse) {
+	return func(ncw *DirectResponse) {
+		ncw.service = service
+		ncw.reportingWriter = reportingWriter
+		ncw.maxBodySize = conf.LimitFor(service)
+		if conf != nil {
+			ncw.exceededStatus = conf.ExceededStatus
+		}
+	}
 }
 
 func (ncw *DirectResponse) String() string {
@@ -82,8 +117,29 @@ func (ncw *DirectResponse) String() string {
 	)
 }
 
+func (ncw *DirectResponse) readBody() ([]byte, error) {
+	data, err := ReadBodyLimited(ncw.boundResp, ncw.maxBodySize)
+	if IsResponseTooLarge(err) {
+		ncw.error = err
+		log.Error().
+			Err(err).
+			Str("service", ncw.service).
+			Int64("maxBodySize", ncw.maxBodySize).
+			Msg("backend response rejected")
+		if ncw.reportingWriter != nil {
+			ncw.reportingWriter.Write(&reporting.ResponseLimitReport{
+				Created: time.Now(),
+				Service: ncw.service,
+				Limit:   ncw.maxBodySize,
+				Status:  ReadErrorStatus(err, ncw.exceededStatus),
+			})
+		}
+	}
+	return data, err
+}
+
 func (ncw *DirectResponse) ExportResponse() ([]byte, error) {
-	data, err := io.ReadAll(ncw.boundResp.GetBodyReader())
+	data, err := ncw.readBody()
 	if err != nil {
 		return nil, fmt.Errorf("failed to export response from DirectResponse: %w", err)
 	}
@@ -92,10 +148,10 @@ func (ncw *DirectResponse) ExportResponse() ([]byte, error) {
 
 // DirectResponse
 func (ncw *DirectResponse) WriteResponse(w http.ResponseWriter) {
-	data, err := io.ReadAll(ncw.boundResp.GetBodyReader())
+	data, err := ncw.readBody()
 	if err != nil {
 		uniresp.WriteJSONErrorResponse(
-			w, uniresp.NewActionErrorFrom(err), http.StatusInternalServerError)
+			w, uniresp.NewActionErrorFrom(err), ReadErrorStatus(err, ncw.exceededStatus))
 		return
 	}
 	jsonAns, err := json.Marshal(data)
@@ -136,13 +192,20 @@ func (ncw *DirectResponse) HandleCacheMiss(fn func() BackendResponse) {
 	ncw.boundResp = fn()
 }
 
-func NewDirectResponse(resp BackendResponse, err error) *DirectResponse {
+func NewDirectResponse(resp BackendResponse, err error, opts ...func(*DirectResponse)) *DirectResponse {
+	var ans *DirectResponse
 	if err != nil {
-		return &DirectResponse{
-			error:     err,
+		ans = &DirectResponse{
+			error: err,
+		}
+
+	} else {
+		ans = &DirectResponse{
+			boundResp: resp,
 		}
 	}
-	return &DirectResponse{
-		boundResp: resp,
+	for _, opt := range opts {
+		opt(ans)
 	}
+	return ans
 }
@@ -0,0 +1,378 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2025 Department of Linguistics,
+//                Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/czcorpus/apiguard-common/reporting"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltKeepAliveInterval = 15 * time.Second
+	streamChunkSize       = 4096
+	sseContentType        = "text/event-stream"
+)
+
+// ErrStreamNotExportable is returned when trying to export
+// a streamed response as a whole.
+var ErrStreamNotExportable = errors.New("streamed response cannot be exported")
+
+// BackendStreamResponse represents a backend response which
+// is expected to be relayed to a client continuously as data arrive
+// (e.g. Server-Sent Events or a chunked response).
+type BackendStreamResponse struct {
+	BodyReader io.ReadCloser
+	Headers    http.Header
+	StatusCode int
+	Err        error
+}
+
+func (sr *BackendStreamResponse) GetBodyReader() io.ReadCloser {
+	return sr.BodyReader
+}
+
+func (sr *BackendStreamResponse) CloseBodyReader() error {
+	return sr.BodyReader.Close()
+}
+
+func (sr *BackendStreamResponse) GetHeaders() http.Header {
+	return sr.Headers
+}
+
+func (sr *BackendStreamResponse) GetStatusCode() int {
+	return sr.StatusCode
+}
+
+func (sr *BackendStreamResponse) Error() error {
+	return sr.Err
+}
+
+func (sr *BackendStreamResponse) IsDataStream() bool {
+	return true
+}
+
+// IsSSE tests whether the response contains Server-Sent Events
+func (sr *BackendStreamResponse) IsSSE() bool {
+	mediaType, _, err := mime.ParseMediaType(sr.Headers.Get("Content-Type"))
+	return err == nil && mediaType == sseContentType
+}
+
+// -----
+
+// StreamingResponse is a ResponseProcessor relaying streamed backend
+// responses. For SSE, data are forwarded event by event, for other
+// streams chunk by chunk. Each forwarded piece is flushed immediately.
+// The response is never cached.
+type StreamingResponse struct {
+	ctx               context.Context
+	service           string
+	reportingWriter   reporting.ReportingWriter
+	keepAliveInterval time.Duration
+	maxEventSize      int64
+	exceededStatus    int
+	error             error
+	boundResp         BackendResponse
+}
+
+// StreamingWithKeepAlive sets an interval of keep-alive comments
+// sent to SSE clients in case there are no events. A zero or negative
+// interval disables keep-alive comments.
+func StreamingWithKeepAlive(interval time.Duration) func(*StreamingResponse) {
+	return func(sr *StreamingResponse) {
+		sr.keepAliveInterval = interval
+	}
+}
+
+// StreamingWithReporting enables reporting of stream durations
+// via reporting.ProxyProcReport
+func StreamingWithReporting(service string, writer reporting.ReportingWriter) func(*StreamingResponse) {
+	return func(sr *StreamingResponse) {
+		sr.service = service
+		sr.reportingWriter = writer
+	}
+}
+
+// StreamingWithEventSizeLimit limits the size of a single SSE event
+// based on the service limit (see BodySizeLimitConf.LimitFor). Once the limit
+// is exceeded, the stream is terminated. As the whole stream may be
+// arbitrarily long, the limit is not applied to non-SSE streams.
+func StreamingWithEventSizeLimit(service string, conf *BodySizeLimitConf) func(*StreamingResponse) {
+	return func(sr *StreamingResponse) {
+		sr.service = service
+		sr.maxEventSize = conf.LimitFor(service)
+		if conf != nil {
+			sr.exceededStatus = conf.ExceededStatus
+		}
+	}
+}
+
+func (sr *StreamingResponse) String() string {
+	return fmt.Sprintf(
+		"StreamingResponse{err: %s, bound: %t, service: %s}",
+		sr.error, sr.boundResp != nil, sr.service,
+	)
+}
+
+func (sr *StreamingResponse) Response() BackendResponse {
+	if sr.boundResp != nil {
+		return sr.boundResp
+	}
+	return &BackendZeroResponse{}
+}
+
+func (sr *StreamingResponse) Error() error {
+	if sr.error != nil {
+		return sr.error
+	}
+	if sr.boundResp != nil && sr.boundResp.Error() != nil {
+		return sr.boundResp.Error()
+	}
+	return nil
+}
+
+func (sr *StreamingResponse) IsCacheHit() bool {
+	return false
+}
+
+func (sr *StreamingResponse) HandleCacheMiss(fn func() BackendResponse) {
+	sr.boundResp = fn()
+}
+
+func (sr *StreamingResponse) ExportResponse() ([]byte, error) {
+	return nil, ErrStreamNotExportable
+}
+
+// readStream reads data from the body and sends them piece by piece
+// to the returned channel. For SSE, a piece is a complete event
+// (i.e. terminated by an empty line), otherwise a chunk of arbitrary size.
+// The channel is closed once the body is exhausted or an error occurs
+// (in which case the error is sent to errCh).
+func (sr *StreamingResponse) readStream(body io.Reader, isSSE bool) (<-chan []byte, <-chan error) {
+	dataCh := make(chan []byte)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(dataCh)
+		rdr := bufio.NewReader(body)
+		if isSSE {
+			var event []byte
+			var midLine bool
+			for {
+				// ReadSlice (unlike ReadBytes) does not buffer a whole line
+				// so we are able to stop on oversized events early
+				line, err := rdr.ReadSlice('\n')
+				event = append(event, line...)
+				if sr.maxEventSize > 0 && int64(len(event)) > sr.maxEventSize {
+					errCh <- &ResponseTooLargeError{Limit: sr.maxEventSize}
+					return
+				}
+				if err == bufio.ErrBufferFull {
+					midLine = true
+					continue
+				}
+				if !midLine && (string(line) == "\n" || string(line) == "\r\n") {
+					dataCh <- event
+					event = nil
+				}
+				midLine = false
+				if err != nil {
+					if len(event) > 0 {
+						dataCh <- event
+					}
+					if err != io.EOF {
+						errCh <- err
+					}
+					return
+				}
+			}
+		}
+		for {
+			buff := make([]byte, streamChunkSize)
+			n, err := rdr.Read(buff)
+			if n > 0 {
+				dataCh <- buff[:n]
+			}
+			if err != nil {
+				if err != io.EOF {
+					errCh <- err
+				}
+				return
+			}
+		}
+	}()
+	return dataCh, errCh
+}
+
+func (sr *StreamingResponse) report(t0 time.Time, status int) {
+	if sr.reportingWriter == nil {
+		return
+	}
+	sr.reportingWriter.Write(&reporting.ProxyProcReport{
+		DateTime: t0,
+		ProcTime: time.Since(t0).Seconds(),
+		Status:   status,
+		Service:  sr.service,
+		IsCached: false,
+	})
+}
+
+func (sr *StreamingResponse) reportLimitExceeded() {
+	if sr.reportingWriter == nil {
+		return
+	}
+	sr.reportingWriter.Write(&reporting.ResponseLimitReport{
+		Created: time.Now(),
+		Service: sr.service,
+		Limit:   sr.maxEventSize,
+		Status:  ReadErrorStatus(&ResponseTooLargeError{Limit: sr.maxEventSize}, sr.exceededStatus),
+	})
+}
+
+// WriteResponse relays the bound stream to the client until
+// the stream ends or the client disconnects (as signaled by the context
+// passed to NewStreamingResponse).
+func (sr *StreamingResponse) WriteResponse(w http.ResponseWriter) {
+	t0 := time.Now()
+	err := sr.Error()
+	if err == nil && sr.boundResp == nil {
+		err = sr.Response().Error()
+	}
+	if err != nil {
+		uniresp.WriteJSONErrorResponse(
+			w, uniresp.NewActionErrorFrom(err), http.StatusBadGateway)
+		sr.report(t0, http.StatusBadGateway)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sr.error = fmt.Errorf("response writer does not support flushing")
+		uniresp.WriteJSONErrorResponse(
+			w, uniresp.NewActionErrorFrom(sr.error), http.StatusInternalServerError)
+		sr.report(t0, http.StatusInternalServerError)
+		return
+	}
+	body := sr.boundResp.GetBodyReader()
+	defer body.Close()
+	isSSE := false
+	if sResp, ok := sr.boundResp.(*BackendStreamResponse); ok {
+		isSSE = sResp.IsSSE()
+	}
+
+	for k, v := range sr.boundResp.GetHeaders() {
+		if k == "Content-Length" {
+			continue
+		}
+		w.Header()[k] = v
+	}
+	if isSSE {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+	status := sr.boundResp.GetStatusCode()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	flusher.Flush()
+
+	var keepAlive <-chan time.Time
+	if isSSE && sr.keepAliveInterval > 0 {
+		ticker := time.NewTicker(sr.keepAliveInterval)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+	dataCh, errCh := sr.readStream(body, isSSE)
+	for {
+		select {
+		case <-sr.ctx.Done():
+			log.Debug().
+				Str("service", sr.service).
+				Msg("client disconnected from stream")
+			// closing body unblocks the reading goroutine
+			body.Close()
+			for range dataCh {
+			}
+			sr.report(t0, status)
+			return
+		case <-keepAlive:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				sr.error = err
+				body.Close()
+				for range dataCh {
+				}
+				sr.report(t0, status)
+				return
+			}
+			flusher.Flush()
+		case chunk, ok := <-dataCh:
+			if !ok {
+				select {
+				case err := <-errCh:
+					sr.error = err
+					log.Error().Err(err).Str("service", sr.service).Msg("failed to read backend stream")
+					if IsResponseTooLarge(err) {
+						sr.reportLimitExceeded()
+					}
+				default:
+				}
+				sr.report(t0, status)
+				return
+			}
+			if _, err := w.Write(chunk); err != nil {
+				sr.error = err
+				body.Close()
+				for range dataCh {
+				}
+				sr.report(t0, status)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// NewStreamingResponse creates a new streaming response processor.
+// The ctx should be the client request's context so the stream
+// is terminated once the client disconnects.
+func NewStreamingResponse(
+	ctx context.Context,
+	resp BackendResponse,
+	err error,
+	opts ...func(*StreamingResponse),
+) *StreamingResponse {
+	ans := &StreamingResponse{
+		ctx:               ctx,
+		keepAliveInterval: dfltKeepAliveInterval,
+		error:             err,
+		boundResp:         resp,
+	}
+	for _, opt := range opts {
+		opt(ans)
+	}
+	return ans
+}
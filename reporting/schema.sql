@@ -34,4 +34,63 @@ create table apiguard_alarm_monitoring (
   num_users int,
   num_requests int
 );
-select create_hypertable('apiguard_alarm_monitoring', 'time');
\ No newline at end of file
+select create_hypertable('apiguard_alarm_monitoring', 'time');
+
+create table apiguard_shadow_guard_monitoring (
+  "time" timestamp with time zone NOT NULL,
+  service TEXT,
+  shadow_guard TEXT,
+  client_ip TEXT,
+  client_id int,
+  shadow_response int,
+  shadow_delay float,
+  shadow_error TEXT,
+  active_response int,
+  agrees boolean
+);
+select create_hypertable('apiguard_shadow_guard_monitoring', 'time');
+
+create table apiguard_guard_decision_monitoring (
+  "time" timestamp with time zone NOT NULL,
+  service TEXT,
+  guard TEXT,
+  client_ip TEXT,
+  client_id int,
+  human_id int,
+  status int,
+  reason TEXT
+);
+select create_hypertable('apiguard_guard_decision_monitoring', 'time');
+
+create table apiguard_ban_monitoring (
+  "time" timestamp with time zone NOT NULL,
+  action TEXT,
+  target_type TEXT,
+  target TEXT,
+  duration float,
+  level int,
+  reason TEXT
+);
+select create_hypertable('apiguard_ban_monitoring', 'time');
+
+create table apiguard_quota_usage_monitoring (
+  "time" timestamp with time zone NOT NULL,
+  user_id int,
+  service TEXT,
+  class TEXT,
+  daily_requests int,
+  monthly_requests int,
+  daily_proc_time float,
+  monthly_proc_time float,
+  daily_limit int,
+  monthly_limit int
+);
+select create_hypertable('apiguard_quota_usage_monitoring', 'time');
+
+create table apiguard_response_limit_monitoring (
+  "time" timestamp with time zone NOT NULL,
+  service TEXT,
+  size_limit bigint,
+  status int
+);
+select create_hypertable('apiguard_response_limit_monitoring', 'time');
\ No newline at end of file
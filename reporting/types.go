@@ -29,6 +29,14 @@ const ProxyMonitoringTable = "apiguard_proxy_monitoring"
 const TelemetryMonitoringTable = "apiguard_telemetry_monitoring"
 const BackendMonitoringTable = "apiguard_backend_monitoring"
 const AlarmMonitoringTable = "apiguard_alarm_monitoring"
+const ShadowGuardMonitoringTable = "apiguard_shadow_guard_monitoring"
+const GuardDecisionMonitoringTable = "apiguard_guard_decision_monitoring"
+const BanMonitoringTable = "apiguard_ban_monitoring"
+const QuotaUsageMonitoringTable = "apiguard_quota_usage_monitoring"
+const ResponseLimitMonitoringTable = "apiguard_response_limit_monitoring"
+
+const BanActionBan = "ban"
+const BanActionUnban = "unban"
 
 const BackendActionTypeQuery = "query"
 const BackendActionTypeLogin = "login"
@@ -221,3 +229,283 @@ func (report *AlarmStatus) MarshalJSON() ([]byte, error) {
 		NumRequests: report.NumRequests,
 	})
 }
+
+// ----
+
+// ShadowGuardReport compares a decision of a guard running in the shadow
+// (dry-run) mode with a decision of the active guard for the same request.
+type ShadowGuardReport struct {
+	Created        time.Time
+	Service        string
+	ShadowGuard    string
+	ClientIP       string
+	ClientID       common.UserID
+	ShadowResponse int
+	ShadowDelay    float64
+	ShadowError    string
+	ActiveResponse int
+}
+
+// Agrees tests whether both the shadow and the active guards
+// would let the request pass (or both would block it)
+func (report *ShadowGuardReport) Agrees() bool {
+	return (report.ShadowResponse >= 400) == (report.ActiveResponse >= 400)
+}
+
+func (report *ShadowGuardReport) ToTimescaleDB(tableWriter *hltscl.TableWriter) *hltscl.Entry {
+	return tableWriter.NewEntry(report.Created).
+		Str("service", report.Service).
+		Str("shadow_guard", report.ShadowGuard).
+		Str("client_ip", report.ClientIP).
+		Int("client_id", int(report.ClientID)).
+		Int("shadow_response", report.ShadowResponse).
+		Float("shadow_delay", report.ShadowDelay).
+		Str("shadow_error", report.ShadowError).
+		Int("active_response", report.ActiveResponse).
+		Bool("agrees", report.Agrees())
+}
+
+func (report *ShadowGuardReport) GetTime() time.Time {
+	return report.Created
+}
+
+func (report *ShadowGuardReport) GetTableName() string {
+	return ShadowGuardMonitoringTable
+}
+
+func (report *ShadowGuardReport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Created        time.Time     `json:"created"`
+		Service        string        `json:"service"`
+		ShadowGuard    string        `json:"shadowGuard"`
+		ClientIP       string        `json:"clientIp"`
+		ClientID       common.UserID `json:"clientId"`
+		ShadowResponse int           `json:"shadowResponse"`
+		ShadowDelay    float64       `json:"shadowDelay"`
+		ShadowError    string        `json:"shadowError,omitempty"`
+		ActiveResponse int           `json:"activeResponse"`
+		Agrees         bool          `json:"agrees"`
+	}{
+		Created:        report.Created,
+		Service:        report.Service,
+		ShadowGuard:    report.ShadowGuard,
+		ClientIP:       report.ClientIP,
+		ClientID:       report.ClientID,
+		ShadowResponse: report.ShadowResponse,
+		ShadowDelay:    report.ShadowDelay,
+		ShadowError:    report.ShadowError,
+		ActiveResponse: report.ActiveResponse,
+		Agrees:         report.Agrees(),
+	})
+}
+
+// ----
+
+// GuardDecisionReport describes a decision of a guard
+// about a request (typically a rejection).
+type GuardDecisionReport struct {
+	Created  time.Time
+	Service  string
+	Guard    string
+	ClientIP string
+	ClientID common.UserID
+	HumanID  common.UserID
+	Status   int
+	Reason   string
+}
+
+func (report *GuardDecisionReport) ToTimescaleDB(tableWriter *hltscl.TableWriter) *hltscl.Entry {
+	return tableWriter.NewEntry(report.Created).
+		Str("service", report.Service).
+		Str("guard", report.Guard).
+		Str("client_ip", report.ClientIP).
+		Int("client_id", int(report.ClientID)).
+		Int("human_id", int(report.HumanID)).
+		Int("status", report.Status).
+		Str("reason", report.Reason)
+}
+
+func (report *GuardDecisionReport) GetTime() time.Time {
+	return report.Created
+}
+
+func (report *GuardDecisionReport) GetTableName() string {
+	return GuardDecisionMonitoringTable
+}
+
+func (report *GuardDecisionReport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Created  time.Time     `json:"created"`
+		Service  string        `json:"service"`
+		Guard    string        `json:"guard"`
+		ClientIP string        `json:"clientIp"`
+		ClientID common.UserID `json:"clientId"`
+		HumanID  common.UserID `json:"humanId"`
+		Status   int           `json:"status"`
+		Reason   string        `json:"reason"`
+	}{
+		Created:  report.Created,
+		Service:  report.Service,
+		Guard:    report.Guard,
+		ClientIP: report.ClientIP,
+		ClientID: report.ClientID,
+		HumanID:  report.HumanID,
+		Status:   report.Status,
+		Reason:   report.Reason,
+	})
+}
+
+// ----
+
+// BanReport describes a ban or unban action
+type BanReport struct {
+	Created    time.Time
+	Action     string
+	TargetType string
+	Target     string
+	Until      time.Time
+	Level      int
+	Reason     string
+}
+
+func (report *BanReport) ToTimescaleDB(tableWriter *hltscl.TableWriter) *hltscl.Entry {
+	return tableWriter.NewEntry(report.Created).
+		Str("action", report.Action).
+		Str("target_type", report.TargetType).
+		Str("target", report.Target).
+		Float("duration", report.Until.Sub(report.Created).Seconds()).
+		Int("level", report.Level).
+		Str("reason", report.Reason)
+}
+
+func (report *BanReport) GetTime() time.Time {
+	return report.Created
+}
+
+func (report *BanReport) GetTableName() string {
+	return BanMonitoringTable
+}
+
+func (report *BanReport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Created    time.Time `json:"created"`
+		Action     string    `json:"action"`
+		TargetType string    `json:"targetType"`
+		Target     string    `json:"target"`
+		Until      time.Time `json:"until"`
+		Level      int       `json:"level"`
+		Reason     string    `json:"reason"`
+	}{
+		Created:    report.Created,
+		Action:     report.Action,
+		TargetType: report.TargetType,
+		Target:     report.Target,
+		Until:      report.Until,
+		Level:      report.Level,
+		Reason:     report.Reason,
+	})
+}
+
+// ----
+
+// QuotaUsageReport describes quota usage of a user after
+// a recorded request
+type QuotaUsageReport struct {
+	Created         time.Time
+	UserID          common.UserID
+	Service         string
+	Class           string
+	DailyRequests   int64
+	MonthlyRequests int64
+	DailyProcTime   float64
+	MonthlyProcTime float64
+	DailyLimit      int64
+	MonthlyLimit    int64
+}
+
+func (report *QuotaUsageReport) ToTimescaleDB(tableWriter *hltscl.TableWriter) *hltscl.Entry {
+	return tableWriter.NewEntry(report.Created).
+		Int("user_id", int(report.UserID)).
+		Str("service", report.Service).
+		Str("class", report.Class).
+		Int("daily_requests", int(report.DailyRequests)).
+		Int("monthly_requests", int(report.MonthlyRequests)).
+		Float("daily_proc_time", report.DailyProcTime).
+		Float("monthly_proc_time", report.MonthlyProcTime).
+		Int("daily_limit", int(report.DailyLimit)).
+		Int("monthly_limit", int(report.MonthlyLimit))
+}
+
+func (report *QuotaUsageReport) GetTime() time.Time {
+	return report.Created
+}
+
+func (report *QuotaUsageReport) GetTableName() string {
+	return QuotaUsageMonitoringTable
+}
+
+func (report *QuotaUsageReport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Created         time.Time     `json:"created"`
+		UserID          common.UserID `json:"userId"`
+		Service         string        `json:"service"`
+		Class           string        `json:"class"`
+		DailyRequests   int64         `json:"dailyRequests"`
+		MonthlyRequests int64         `json:"monthlyRequests"`
+		DailyProcTime   float64       `json:"dailyProcTime"`
+		MonthlyProcTime float64       `json:"monthlyProcTime"`
+		DailyLimit      int64         `json:"dailyLimit"`
+		MonthlyLimit    int64         `json:"monthlyLimit"`
+	}{
+		Created:         report.Created,
+		UserID:          report.UserID,
+		Service:         report.Service,
+		Class:           report.Class,
+		DailyRequests:   report.DailyRequests,
+		MonthlyRequests: report.MonthlyRequests,
+		DailyProcTime:   report.DailyProcTime,
+		MonthlyProcTime: report.MonthlyProcTime,
+		DailyLimit:      report.DailyLimit,
+		MonthlyLimit:    report.MonthlyLimit,
+	})
+}
+
+// ----
+
+// ResponseLimitReport records a backend response rejected
+// because of its exceeded body size limit
+type ResponseLimitReport struct {
+	Created time.Time
+	Service string
+	Limit   int64
+	Status  int
+}
+
+func (report *ResponseLimitReport) ToTimescaleDB(tableWriter *hltscl.TableWriter) *hltscl.Entry {
+	return tableWriter.NewEntry(report.Created).
+		Str("service", report.Service).
+		Int("size_limit", int(report.Limit)).
+		Int("status", report.Status)
+}
+
+func (report *ResponseLimitReport) GetTime() time.Time {
+	return report.Created
+}
+
+func (report *ResponseLimitReport) GetTableName() string {
+	return ResponseLimitMonitoringTable
+}
+
+func (report *ResponseLimitReport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Created time.Time `json:"created"`
+		Service string    `json:"service"`
+		Limit   int64     `json:"limit"`
+		Status  int       `json:"status"`
+	}{
+		Created: report.Created,
+		Service: report.Service,
+		Limit:   report.Limit,
+		Status:  report.Status,
+	})
+}